@@ -4,38 +4,60 @@ import (
 	"crypto/rand"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"path"
 	"slices"
+	"strings"
 
 	"github.com/qmk-analyzer/internal/qmk"
 )
 
-func extractFileUpload(r *http.Request, formFileName, expectedType string, sizeLimit int64) ([]byte, error) {
+func extractFileUpload(r *http.Request, formFileName string, expectedTypes []string, sizeLimit int64) ([]byte, string, error) {
 	r.ParseMultipartForm(sizeLimit)
 
 	f, handler, err := r.FormFile(formFileName)
-	defer f.Close()
-
 	if err != nil {
-		return []byte{}, err
+		return []byte{}, "", err
 	}
+	defer f.Close()
 
 	if handler.Size > sizeLimit {
-		return []byte{}, err
+		return []byte{}, "", fmt.Errorf("upload %s is larger than %d bytes", handler.Filename, sizeLimit)
 	}
 
 	contentType := handler.Header.Get("Content-Type")
-	if contentType != expectedType {
-		return []byte{}, err
+	if !slices.Contains(expectedTypes, contentType) {
+		return []byte{}, "", fmt.Errorf("upload %s has content type %s, expected one of %v", handler.Filename, contentType, expectedTypes)
 	}
 
 	bytes, err := io.ReadAll(f)
 	if err != nil {
-		return []byte{}, err
+		return []byte{}, "", err
 	}
 
-	return bytes, nil
+	return bytes, handler.Filename, nil
+}
+
+// uploadDirName returns the name of the directory an upload came from, as in
+// keymaps/<name>/keymap.c, or "" when the client only sent a file name.
+// FileHeader.Filename has the directory stripped, so the raw header is read.
+func uploadDirName(r *http.Request, formFileName string) string {
+	if r.MultipartForm == nil || len(r.MultipartForm.File[formFileName]) == 0 {
+		return ""
+	}
+
+	_, params, err := mime.ParseMediaType(r.MultipartForm.File[formFileName][0].Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+
+	dir := path.Base(path.Dir(strings.ReplaceAll(params["filename"], "\\", "/")))
+	if dir == "." || dir == "/" || dir == ".." {
+		return ""
+	}
+
+	return dir
 }
 
 func getRandomFilename(extension string) (string, error) {
@@ -45,6 +67,30 @@ func getRandomFilename(extension string) (string, error) {
 	return fmt.Sprintf("%x%s", name, extension), err
 }
 
+// analysisInput fills the analysis form in with the last text and scoring
+// profile used.
+type analysisInput struct {
+	Text                 string
+	ScoringProfiles      []qmk.ScoringProfile
+	ScoringProfile       string
+	CustomScoringProfile string
+}
+
+// findScoringProfile looks a profile up by name, the default when empty.
+func (app *application) findScoringProfile(name string) (qmk.ScoringProfile, bool) {
+	if name == "" {
+		return qmk.DefaultScoringProfile, true
+	}
+
+	for _, profile := range app.scoringProfiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+
+	return qmk.ScoringProfile{}, false
+}
+
 func (app *application) respondWithAnalysisPage(w http.ResponseWriter, sessionData SessionData, layer int) {
 	keyboard, err := app.qmkHelper.GetKeyboard(sessionData.Layout, sessionData.Keymap, layer)
 	if err != nil {
@@ -72,7 +118,7 @@ func (app *application) respondWithAnalysisPage(w http.ResponseWriter, sessionDa
 		Keyboard      qmk.Keyboard
 		Analysis      any
 		KeymapOptions selectOptions
-		Text          string
+		Input         analysisInput
 	}
 
 	keymapSelectOptions := selectOptions{
@@ -95,7 +141,12 @@ func (app *application) respondWithAnalysisPage(w http.ResponseWriter, sessionDa
 		SessionID:     sessionData.ID,
 		Keyboard:      keyboard,
 		KeymapOptions: keymapSelectOptions,
-		Text:          sessionData.AnalysisText,
+		Input: analysisInput{
+			Text:                 sessionData.AnalysisText,
+			ScoringProfiles:      app.scoringProfiles,
+			ScoringProfile:       sessionData.ScoringProfile,
+			CustomScoringProfile: sessionData.CustomScoringProfile,
+		},
 	}
 
 	analysis, ok := sessionData.AnalysisData[sessionData.Keymap.Path]
@@ -209,7 +260,14 @@ func (app *application) respondWithFingermapCreator(w http.ResponseWriter, sessi
 	}
 }
 
+// layoutExists finds the keymap's layout, from its keyboard in qmk_firmware
+// or from the layout files, and asks for an upload when there is none.
 func (app *application) layoutExists(w http.ResponseWriter, sessionData SessionData) (qmk.Layout, bool) {
+	layout, layoutErr := app.qmkHelper.GetLayoutForKeymap(sessionData.Keymap)
+	if layoutErr == nil {
+		return layout, true
+	}
+
 	layouts, err := app.qmkHelper.GetAllLayouts()
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -226,12 +284,7 @@ func (app *application) layoutExists(w http.ResponseWriter, sessionData SessionD
 		return qmk.Layout{}, false
 	}
 
-	layout, err := app.qmkHelper.GetLayoutData(sessionData.Keymap.Layout)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		app.logger.Error(err.Error())
-		return qmk.Layout{}, false
-	}
-
-	return layout, true
+	w.WriteHeader(http.StatusInternalServerError)
+	app.logger.Error(layoutErr.Error())
+	return qmk.Layout{}, false
 }
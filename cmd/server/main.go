@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"path"
 	"runtime"
 	"sync"
 	"time"
@@ -26,16 +27,29 @@ type config struct {
 	keymapDir         string
 	fingermapDir      string
 	saveKeymapUploads bool
+	keycodeSpecDir    string
+	qmkFirmwareDir    string
+	scoringProfileDir string
+	effortModel       string
+	returnHome        int
+	skipgram          struct {
+		distance int
+		decay    float64
+	}
 }
 
 type application struct {
-	cfg          config
-	logger       *slog.Logger
-	mux          *http.ServeMux
-	wg           sync.WaitGroup
-	qmkHelper    *qmk.QMKHelper
-	templates    *template.Template
-	sessionCache cache.MemoryCache
+	cfg       config
+	logger    *slog.Logger
+	mux       *http.ServeMux
+	wg        sync.WaitGroup
+	qmkHelper *qmk.QMKHelper
+	templates *template.Template
+	// scoringProfiles are the built-in presets followed by any profiles
+	// loaded from -scoring-profile-dir
+	scoringProfiles []qmk.ScoringProfile
+	effortModel     qmk.EffortModel
+	sessionCache    cache.MemoryCache
 }
 
 func main() {
@@ -51,22 +65,76 @@ func main() {
 	flag.Float64Var(&app.cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&app.cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 
-	// flag.StringVar(&app.cfg.keyboardDir, "keyboard-dir", "keyboards/", "Root directory for qmk keyboards")
+	flag.StringVar(&app.cfg.qmkFirmwareDir, "qmk-firmware-dir", "", "Local qmk_firmware checkout to find keyboard layouts, default keymaps and keycodes in")
 	flag.StringVar(&app.cfg.layoutDir, "layout-dir", "assets/example_configs/layouts/", "Root directory for qmk layouts")
 	flag.StringVar(&app.cfg.fingermapDir, "fingermap-dir", "assets/example_configs/fingermaps/", "Root directory for qmk keycodes")
 	flag.StringVar(&app.cfg.keymapDir, "keymap-dir", "assets/example_configs/keymaps/", "Root directory for uploaded qmk keycodes")
 
 	flag.BoolVar(&app.cfg.saveKeymapUploads, "save-uploads", true, "Save keymap uploads to dist")
+	flag.StringVar(&app.cfg.keycodeSpecDir, "keycode-spec-dir", "", "QMK keycode spec directory (qmk_firmware/data/constants/keycodes), uses the bundled subset when empty")
+
+	flag.IntVar(&app.cfg.skipgram.distance, "skipgram-distance", 3, "Most keys in between two presses of a finger that still count as a skipgram")
+	flag.Float64Var(&app.cfg.skipgram.decay, "skipgram-decay", 0.5, "Weight factor of a skipgram for every key further apart")
+
+	flag.StringVar(&app.cfg.scoringProfileDir, "scoring-profile-dir", "", "Directory of scoring profile files offered next to the built-in presets")
+
+	flag.IntVar(&app.cfg.returnHome, "return-home", 0, "Key presses after which an idle finger returns to its home key, 0 to never return")
+
+	flag.StringVar(&app.cfg.effortModel, "effort-model", "", "Effort model file with Carpalx parameters, uses the built-in carpalx model when empty")
 
 	flag.Parse()
 
+	// a checkout brings the full keycode spec along
+	if app.cfg.keycodeSpecDir == "" && app.cfg.qmkFirmwareDir != "" {
+		specDir := path.Join(app.cfg.qmkFirmwareDir, "data", "constants", "keycodes")
+		if _, err := os.Stat(specDir); err == nil {
+			app.cfg.keycodeSpecDir = specDir
+		}
+	}
+
+	if app.cfg.keycodeSpecDir != "" {
+		err := qmk.SetKeycodeSpecDir(app.cfg.keycodeSpecDir)
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
 	qmkHelper, err := qmk.NewQMKHelper(app.cfg.layoutDir, app.cfg.keymapDir, app.cfg.fingermapDir)
 	if err != nil {
 		app.logger.Error(err.Error())
 		os.Exit(1)
 	}
 
+	if app.cfg.qmkFirmwareDir != "" {
+		err = qmkHelper.IndexQMKFirmware(app.cfg.qmkFirmwareDir)
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
 	app.qmkHelper = qmkHelper
+
+	app.scoringProfiles = append(app.scoringProfiles, qmk.BuiltinScoringProfiles...)
+	if app.cfg.scoringProfileDir != "" {
+		profiles, err := qmk.LoadScoringProfiles(app.cfg.scoringProfileDir)
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+		app.scoringProfiles = append(app.scoringProfiles, profiles...)
+	}
+
+	app.effortModel = qmk.DefaultEffortModel
+	if app.cfg.effortModel != "" {
+		app.effortModel, err = qmk.LoadEffortModel(app.cfg.effortModel)
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
 	app.templates = app.parseTemplates()
 
 	expvar.Publish("goroutines", expvar.Func(func() any {
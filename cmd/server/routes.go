@@ -6,10 +6,13 @@ import (
 	"expvar"
 	"fmt"
 	"html/template"
+	"math"
 	"net/http"
 	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/qmk-analyzer/internal/qmk"
 )
@@ -19,6 +22,10 @@ var (
 	css embed.FS
 )
 
+// keymapUploadTypes are the content types browsers send for QMK Configurator
+// JSON, keymap.c, ZMK .keymap and Vial/VIA export files.
+var keymapUploadTypes = []string{"application/json", "text/x-csrc", "text/x-c", "text/plain", "application/octet-stream"}
+
 type SelectOption struct {
 	Name string
 	ID   string
@@ -41,6 +48,10 @@ type SessionData struct {
 	ID           string
 	AnalysisData map[string]qmk.AnalysisData
 	AnalysisText string
+	// ScoringProfile is the name of the profile last analyzed with, custom
+	// profiles pasted into the form are kept whole.
+	ScoringProfile       string
+	CustomScoringProfile string
 }
 
 func (app *application) handleKeymapChange(w http.ResponseWriter, r *http.Request, sessionData SessionData) {
@@ -183,7 +194,7 @@ func (app *application) handleLayerSelect(w http.ResponseWriter, r *http.Request
 }
 
 func (app *application) handleKeymapUpload(w http.ResponseWriter, r *http.Request, sessionData SessionData) {
-	bytes, err := extractFileUpload(r, "keymap-file", "application/json", 1<<20)
+	bytes, filename, err := extractFileUpload(r, "keymap-file", keymapUploadTypes, 1<<20)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		app.logger.Error(err.Error())
@@ -191,7 +202,77 @@ func (app *application) handleKeymapUpload(w http.ResponseWriter, r *http.Reques
 	}
 
 	keymapData := qmk.KeymapData{}
-	err = json.Unmarshal(bytes, &keymapData)
+	layoutName := r.FormValue("keymap-layout")
+
+	// only QMK Configurator JSON names its keyboard, the others can be given
+	// one so their layout is looked up in qmk_firmware
+	keyboardName := r.FormValue("keymap-keyboard")
+	lookup := qmk.KeymapData{Keyboard: keyboardName, Layout: layoutName}
+
+	// every keymap.c is called keymap.c, so it is named after its directory
+	// as in keymaps/<name>/keymap.c unless a name is given
+	name := r.FormValue("keymap-name")
+	if name == "" {
+		name = uploadDirName(r, "keymap-file")
+	}
+	if name == "" && path.Ext(filename) != ".c" {
+		name = strings.TrimSuffix(filename, path.Ext(filename))
+	}
+
+	// keymap.c, ZMK, Vial and VIA uploads are stored converted, so they load
+	// like any other keymap
+	switch {
+	case path.Ext(filename) == ".c":
+		err = qmk.ParseKeymapC(string(bytes), name, &keymapData)
+		if err == nil && name == "" {
+			err = fmt.Errorf("a keymap name is needed for %s", filename)
+		}
+
+		// the plain LAYOUT macro doesn't say which layout the keymap is for
+		if err == nil && keymapData.Layout == "LAYOUT" && layoutName != "" {
+			keymapData.Layout = layoutName
+		}
+		keymapData.Keyboard = keyboardName
+		if err == nil {
+			bytes, err = json.Marshal(keymapData)
+		}
+	case path.Ext(filename) == ".keymap":
+		err = qmk.ParseZMKKeymap(string(bytes), name, &keymapData)
+		keymapData.Layout = layoutName
+		keymapData.Keyboard = keyboardName
+		if err == nil && layoutName == "" {
+			err = fmt.Errorf("a layout is needed for ZMK keymap %s", filename)
+		}
+		if err == nil {
+			bytes, err = json.Marshal(keymapData)
+		}
+	case path.Ext(filename) == ".vil":
+		var layout qmk.Layout
+		layout, err = app.qmkHelper.GetLayoutForKeymap(&lookup)
+		if err == nil {
+			err = qmk.ParseVial(bytes, name, layoutName, layout, &keymapData)
+		}
+		keymapData.Keyboard = keyboardName
+		if err == nil {
+			bytes, err = json.Marshal(keymapData)
+		}
+	default:
+		err = qmk.DecodeConfig(bytes, &keymapData)
+
+		// VIA exports have no layout, their layers are in matrix order
+		if err == nil && keymapData.Layout == "" && layoutName != "" {
+			var layout qmk.Layout
+			layout, err = app.qmkHelper.GetLayoutForKeymap(&lookup)
+			if err == nil {
+				keymapData = qmk.KeymapData{}
+				err = qmk.ParseVIA(bytes, "", layoutName, layout, &keymapData)
+			}
+			keymapData.Keyboard = keyboardName
+			if err == nil {
+				bytes, err = json.Marshal(keymapData)
+			}
+		}
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		app.logger.Error(err.Error())
@@ -200,7 +281,7 @@ func (app *application) handleKeymapUpload(w http.ResponseWriter, r *http.Reques
 
 	if keymapData.Layout == "LAYOUT" {
 		w.WriteHeader(http.StatusBadRequest)
-		app.logger.Error("layout field must not be LAYOUT")
+		app.logger.Error("layout field must not be LAYOUT, enter the layout alongside the file")
 		return
 	}
 
@@ -233,7 +314,7 @@ func (app *application) handleKeymapUpload(w http.ResponseWriter, r *http.Reques
 }
 
 func (app *application) handleLayoutUpload(w http.ResponseWriter, r *http.Request, sessionData SessionData) {
-	bytes, err := extractFileUpload(r, "layout-file", "application/json", 1<<20)
+	bytes, _, err := extractFileUpload(r, "layout-file", []string{"application/json", "text/plain"}, 1<<20)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		app.logger.Error(err.Error())
@@ -241,22 +322,25 @@ func (app *application) handleLayoutUpload(w http.ResponseWriter, r *http.Reques
 	}
 
 	layoutData := qmk.LayoutData{}
-	err = json.Unmarshal(bytes, &layoutData)
+	err = qmk.ParseLayoutJSON(bytes, sessionData.Keymap.Layout, &layoutData)
+
+	// KLE uploads are stored converted, so they load like any other layout
+	if err == nil && qmk.IsKLE(bytes) {
+		bytes, err = json.Marshal(layoutData)
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		app.logger.Error(err.Error())
 		return
 	}
 
-	layoutSlice, ok := layoutData.Layout[sessionData.Keymap.Layout]
+	layout, ok := layoutData.Resolve(sessionData.Keymap.Layout)
 	if !ok {
 		w.WriteHeader(http.StatusBadRequest)
-		app.logger.Error(fmt.Sprintf("layout %s could not be found in uploaded data: %+v", sessionData.Keymap.Layout, layoutData))
+		app.logger.Error(fmt.Sprintf("layout %s could not be found in uploaded data, it has %v", sessionData.Keymap.Layout, layoutData.Names()))
 		return
 	}
 
-	layout := layoutSlice["layout"]
-
 	_, err = app.qmkHelper.SaveLayout(sessionData.Keymap.Layout, bytes)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -303,6 +387,25 @@ func (app *application) handleKeymapSelect(w http.ResponseWriter, r *http.Reques
 func (app *application) handleAnalyze(w http.ResponseWriter, r *http.Request, sessionData SessionData) {
 	text := r.FormValue("text")
 	repeats := r.FormValue("repeats") == "on"
+	lookahead := r.FormValue("lookahead") == "on"
+
+	profile, ok := app.findScoringProfile(r.FormValue("scoring-profile"))
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		app.logger.Error(fmt.Sprintf("scoring profile %s not found", r.FormValue("scoring-profile")))
+		return
+	}
+
+	custom := strings.TrimSpace(r.FormValue("scoring-profile-custom"))
+	if custom != "" {
+		var err error
+		profile, err = qmk.ParseScoringProfile([]byte(custom), "custom")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			app.logger.Error(err.Error())
+			return
+		}
+	}
 
 	keymaps, err := app.qmkHelper.GetCustomKeymapsForLayouts(sessionData.Keymap.Layout)
 	if err != nil {
@@ -311,37 +414,52 @@ func (app *application) handleAnalyze(w http.ResponseWriter, r *http.Request, se
 		return
 	}
 
+	// keymaps from qmk_firmware live outside the keymap directory
+	if !slices.ContainsFunc(keymaps, func(keymap qmk.KeymapOption) bool { return keymap.ID == sessionData.Keymap.Path }) {
+		keymaps = append(keymaps, qmk.KeymapOption{
+			Name:   sessionData.Keymap.Keymap,
+			Layout: sessionData.Keymap.Layout,
+			ID:     sessionData.Keymap.Path,
+		})
+	}
+
 	sessionData.AnalysisText = text
 	sessionData.AnalysisData = make(map[string]qmk.AnalysisData)
+	sessionData.ScoringProfile = profile.Name
+	sessionData.CustomScoringProfile = custom
 
 	for _, keymap := range keymaps {
 		keymapData, err := app.qmkHelper.GetKeymapData(keymap.ID)
 		if err != nil {
 			w.WriteHeader(500)
 			app.logger.Error(err.Error())
+			return
 		}
 
-		layers, err := keymapData.ParseLayers()
+		sequencer, err := app.qmkHelper.NewKeymapSequencer(&keymapData, *sessionData.FingerMap, *sessionData.Layout)
 		if err != nil {
 			w.WriteHeader(500)
 			app.logger.Error(err.Error())
+			return
 		}
 
-		keyfinder, err := qmk.CreateKeyfinder(layers, *sessionData.FingerMap)
-		if err != nil {
-			w.WriteHeader(500)
-			app.logger.Error(err.Error())
+		sequencer.ReturnHome = app.cfg.returnHome
+		sequencer.SkipgramWeights = qmk.SkipgramWeights(app.cfg.skipgram.distance, app.cfg.skipgram.decay)
+		sequencer.EffortModel = app.effortModel
+		if lookahead {
+			sequencer.Mode = qmk.LookaheadMode
 		}
 
-		sequencer := qmk.NewSequencer(keyfinder, *sessionData.Layout)
-
 		err = sequencer.Build(text)
 		if err != nil {
 			w.WriteHeader(500)
 			app.logger.Error(err.Error())
+			return
 		}
 
 		data := sequencer.Analyze(repeats)
+		data.Score = profile.Score(data)
+		data.ScoringProfile = profile.Name
 		sessionData.AnalysisData[keymap.ID] = data
 	}
 
@@ -411,7 +529,14 @@ func (app *application) handleIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) parseTemplates() *template.Template {
-	return template.Must(template.ParseGlob(filepath.Join("cmd/server/templates", "*.html")))
+	// metric values are kept unrounded for scoring, round only shows them
+	funcs := template.FuncMap{
+		"round": func(value float64) float64 {
+			return math.Round(value*100) / 100
+		},
+	}
+
+	return template.Must(template.New("").Funcs(funcs).ParseGlob(filepath.Join("cmd/server/templates", "*.html")))
 }
 
 func (app *application) routes() http.Handler {
@@ -3,7 +3,7 @@ module github.com/qmk-analyzer
 go 1.22.0
 
 require (
-	github.com/hjson/hjson-go/v4 v4.4.0 // indirect
-	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce // indirect
-	golang.org/x/time v0.5.0 // indirect
+	github.com/hjson/hjson-go/v4 v4.4.0
+	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce
+	golang.org/x/time v0.5.0
 )
@@ -1,6 +1,7 @@
 package qmk
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"slices"
@@ -11,6 +12,10 @@ import (
 
 type KeyFinder map[string][]KeyPress
 
+// ComboFinder maps a combo's output to the keys that chord it, one set per
+// layer the combo can be triggered from.
+type ComboFinder map[string][][]KeyPress
+
 type KeyPress struct {
 	Finger  int
 	Index   int
@@ -19,17 +24,15 @@ type KeyPress struct {
 	Val     string
 }
 
+// AnalysisData holds the result of every registered metric, see
+// RegisterMetric, and the score a scoring profile gave them.
 type AnalysisData struct {
-	SFBCounts       []CountEntry
-	SFBFingerCounts [10]int
-	SFBTotal        int
-	LayerSwitches   int
-	LayerCounts     []int
-	FingerTravel    [10]float64
-	TotalTravel     float64
-	FingerCounts    [10]int
-	LayersUsed      int
-	Score           float64
+	Metrics []MetricResult
+	// Characters is the length of the analyzed text, which scores can be
+	// normalized by.
+	Characters     int
+	Score          float64
+	ScoringProfile string
 }
 
 type CountEntry struct {
@@ -39,6 +42,7 @@ type CountEntry struct {
 
 type Sequencer struct {
 	KeyFinder       KeyFinder
+	Combos          ComboFinder
 	LayerStack      []int
 	Occupied        map[int]KeyPress
 	Sequence        []SequenceEvent
@@ -47,6 +51,56 @@ type Sequencer struct {
 	Layout          Layout
 	MovementWeights [10]MovementCost
 	LayerChanges    map[string][]SequenceEvent
+	OneShotLayer    int
+	OneShotShift    bool
+	Mode            SequencerMode
+	BeamWidth       int
+	// SkipgramWeights weighs same finger skipgrams by how many keys apart
+	// they are, starting with one key in between.
+	SkipgramWeights []float64
+	// EffortModel works out the effort metric.
+	EffortModel EffortModel
+	// Home is the layout index of the key each finger rests on, -1 for
+	// fingers without one. Fingers start a sequence there.
+	Home [10]int
+	// Pitch is the spacing of the keys, which distances are measured in.
+	Pitch KeyPitch
+	// ReturnHome is how many key presses a finger stays where it last
+	// pressed before returning home, 0 to never return.
+	ReturnHome int
+	// idle counts the key presses since each finger last pressed one.
+	idle        [10]int
+	characters  int
+	transparent map[[2]int]bool
+}
+
+type SequencerMode int
+
+const (
+	GreedyMode SequencerMode = iota
+	LookaheadMode
+)
+
+const defaultBeamWidth = 8
+
+// defaultSkipgramDistance and defaultSkipgramDecay give skipgrams with one,
+// two and three keys in between the weights 1, 0.5 and 0.25.
+const (
+	defaultSkipgramDistance = 3
+	defaultSkipgramDecay    = 0.5
+)
+
+// SkipgramWeights weighs skipgrams with up to distance keys in between, the
+// weight shrinking by decay for every key further apart.
+func SkipgramWeights(distance int, decay float64) []float64 {
+	weights := []float64{}
+	weight := 1.0
+	for range distance {
+		weights = append(weights, weight)
+		weight *= decay
+	}
+
+	return weights
 }
 
 type SequenceEvent struct {
@@ -54,9 +108,63 @@ type SequenceEvent struct {
 	KeyPress
 }
 
+// MovementCost is what a finger pays for every keyboard unit it moves in
+// each direction. Inward is towards the other hand, Up is away from the
+// typist.
 type MovementCost struct {
-	X float64
-	Y float64
+	Inward  float64 `json:"inward"`
+	Outward float64 `json:"outward"`
+	Up      float64 `json:"up"`
+	Down    float64 `json:"down"`
+}
+
+// DefaultMovementCost makes every direction cost the same, so movement costs
+// are plain distances.
+var DefaultMovementCost = MovementCost{Inward: 1, Outward: 1, Up: 1, Down: 1}
+
+// UnmarshalJSON leaves the directions a file doesn't mention at their
+// default cost.
+func (c *MovementCost) UnmarshalJSON(b []byte) error {
+	type movementCost MovementCost
+	cost := movementCost(DefaultMovementCost)
+
+	err := json.Unmarshal(b, &cost)
+	if err != nil {
+		return err
+	}
+
+	*c = MovementCost(cost)
+
+	return nil
+}
+
+// Distance weighs the move of a fingermap finger from p1 to p2 by direction,
+// the horizontal and vertical parts being combined like a Euclidean
+// distance, in millimeters for keys spaced pitch apart.
+func (c MovementCost) Distance(finger int, p1, p2 KeyPosition, pitch KeyPitch) float64 {
+	x1, y1 := p1.Center()
+	x2, y2 := p2.Center()
+	dx, dy := pitch.Millimeters(x2-x1, y2-y1)
+
+	// the right hand's inward direction is to the left
+	hand, _ := fingerHand(finger)
+	if hand == 1 {
+		dx = -dx
+	}
+
+	if dx > 0 {
+		dx *= c.Inward
+	} else {
+		dx *= c.Outward
+	}
+
+	if dy < 0 {
+		dy *= c.Up
+	} else {
+		dy *= c.Down
+	}
+
+	return math.Sqrt(dx*dx + dy*dy)
 }
 
 func NewSequencer(keyFinder KeyFinder, layout Layout) *Sequencer {
@@ -65,7 +173,24 @@ func NewSequencer(keyFinder KeyFinder, layout Layout) *Sequencer {
 		LayerStack:   []int{0},
 		Occupied:     make(map[int]KeyPress),
 		LastLocation: [10]int{-1, -1, -1, -1, -1, -1, -1, -1, -1, -1},
+		Home:         [10]int{-1, -1, -1, -1, -1, -1, -1, -1, -1, -1},
+		Pitch:        DefaultKeyPitch,
+		MovementWeights: [10]MovementCost{
+			DefaultMovementCost, DefaultMovementCost, DefaultMovementCost, DefaultMovementCost, DefaultMovementCost,
+			DefaultMovementCost, DefaultMovementCost, DefaultMovementCost, DefaultMovementCost, DefaultMovementCost,
+		},
 		Layout:       layout,
+		OneShotLayer: -1,
+		Mode:         GreedyMode,
+		BeamWidth:    defaultBeamWidth,
+		transparent:  make(map[[2]int]bool),
+
+		SkipgramWeights: SkipgramWeights(defaultSkipgramDistance, defaultSkipgramDecay),
+		EffortModel:     DefaultEffortModel,
+	}
+
+	for _, keyPress := range keyFinder["<trans>"] {
+		s.transparent[[2]int{keyPress.Layer, keyPress.Index}] = true
 	}
 
 	s.CreateLayerChangeEvents()
@@ -79,7 +204,10 @@ func (s *Sequencer) Reset(resetSequence bool) {
 	if resetSequence {
 		s.Sequence = []SequenceEvent{}
 	}
-	s.LastLocation = [10]int{-1, -1, -1, -1, -1, -1, -1, -1, -1, -1}
+	s.LastLocation = s.Home
+	s.idle = [10]int{}
+	s.OneShotLayer = -1
+	s.OneShotShift = false
 	s.CreateLayerChangeEvents()
 }
 
@@ -91,7 +219,71 @@ func (s *Sequencer) ActiveLayer() int {
 	return s.LayerStack[len(s.LayerStack)-1]
 }
 
+// ResolvedLayer returns the layer whose key is used at index given the
+// current layer stack, falling through transparent keys to the next active
+// layer below. It returns -1 if every active layer is transparent there.
+func (s *Sequencer) ResolvedLayer(index int) int {
+	for i := len(s.LayerStack) - 1; i >= 0; i-- {
+		layer := s.LayerStack[i]
+		if !s.transparent[[2]int{layer, index}] {
+			return layer
+		}
+	}
+
+	return -1
+}
+
+func (s *Sequencer) removeLayer(layer int) {
+	for i := len(s.LayerStack) - 1; i > 0; i-- {
+		if s.LayerStack[i] == layer {
+			s.LayerStack = slices.Delete(s.LayerStack, i, i+1)
+			return
+		}
+	}
+}
+
+func (s *Sequencer) releaseHeldLayers() {
+	fingers := []int{}
+	for finger := range s.Occupied {
+		fingers = append(fingers, finger)
+	}
+	sort.Ints(fingers)
+
+	for _, finger := range fingers {
+		keyPress := s.Occupied[finger]
+		if !isLayerKey(keyPress.Val) {
+			continue
+		}
+
+		delete(s.Occupied, finger)
+		s.removeLayer(layerTarget(keyPress.Val))
+		s.Sequence = append(s.Sequence, heldLayerRelease(keyPress))
+	}
+}
+
+func heldLayerRelease(keyPress KeyPress) SequenceEvent {
+	keyPress.Layer = layerTarget(keyPress.Val)
+	return SequenceEvent{
+		Action:   "layer-release",
+		KeyPress: keyPress,
+	}
+}
+
+func isLayerKey(val string) bool {
+	parts := strings.Split(val, " ")
+	return len(parts) == 2 && slices.Contains([]string{"LT", "MO", "TG", "TO", "DF", "OSL"}, parts[0])
+}
+
+func layerTarget(val string) int {
+	target, _ := strconv.Atoi(strings.Split(val, " ")[1])
+	return target
+}
+
 func (s *Sequencer) Shifted() bool {
+	if s.OneShotShift {
+		return true
+	}
+
 	for _, keyPress := range s.Occupied {
 		if strings.Contains(keyPress.Val, "sft") {
 			return true
@@ -111,17 +303,22 @@ func (s *Sequencer) GetActiveShift() (int, KeyPress) {
 	return -1, KeyPress{}
 }
 
+// GetShiftKeys returns the one-shot shift keys followed by the held shift
+// keys, so one-shot shift wins when both cost the same.
 func (s *Sequencer) GetShiftKeys() []KeyPress {
-	return append(s.KeyFinder["lsft"], s.KeyFinder["rsft"]...)
+	shiftKeys := []KeyPress{}
+	shiftKeys = append(shiftKeys, s.KeyFinder["OSM lsft"]...)
+	shiftKeys = append(shiftKeys, s.KeyFinder["OSM rsft"]...)
+	shiftKeys = append(shiftKeys, s.KeyFinder["lsft"]...)
+	return append(shiftKeys, s.KeyFinder["rsft"]...)
 }
 
-func (s *Sequencer) CanBePlayed(keyPress KeyPress) bool {
-	if s.Shifted() && !keyPress.Shifted {
-		finger, shiftKey := s.GetActiveShift()
-		if finger == -1 {
-			panic("sequencer shifted but couldn't find active shift key")
-		}
+func isOneShotMod(val string) bool {
+	return strings.HasPrefix(val, "OSM ")
+}
 
+func (s *Sequencer) CanBePlayed(keyPress KeyPress) bool {
+	if finger, shiftKey := s.GetActiveShift(); finger != -1 && !keyPress.Shifted {
 		delete(s.Occupied, finger)
 		defer func() { s.Occupied[finger] = shiftKey }()
 	}
@@ -136,7 +333,7 @@ func (s *Sequencer) CanBePlayed(keyPress KeyPress) bool {
 		}
 	}
 
-	if keyPress.Layer != s.ActiveLayer() {
+	if keyPress.Layer != s.ResolvedLayer(keyPress.Index) {
 		return false
 	}
 
@@ -180,11 +377,35 @@ func (s *Sequencer) fingerMoveCost(targetIndex, finger int) float64 {
 		return 0
 	}
 
-	dx := s.Layout[targetIndex].X - s.Layout[s.LastLocation[finger-1]].X
-	dy := s.Layout[targetIndex].Y - s.Layout[s.LastLocation[finger-1]].Y
+	// costs are in MX keys, so they weigh the same against layer changes
+	// whatever the spacing
+	distance := s.MovementWeights[finger-1].Distance(finger, s.Layout[s.LastLocation[finger-1]], s.Layout[targetIndex], s.Pitch)
+	return distance / DefaultKeyPitch.X
+}
+
+func (s *Sequencer) moveFinger(keyPress KeyPress) {
+	if keyPress.Finger < 1 || keyPress.Finger > len(s.LastLocation) {
+		return
+	}
+
+	s.LastLocation[keyPress.Finger-1] = keyPress.Index
+	returnFingers(&s.LastLocation, &s.idle, s.Home, s.ReturnHome, keyPress.Finger)
+}
+
+// returnFingers updates where the fingers are once finger pressed a key,
+// sending the fingers idle for returnHome presses back home.
+func returnFingers(locations, idle *[10]int, home [10]int, returnHome, finger int) {
+	for i := range idle {
+		if i == finger-1 {
+			idle[i] = 0
+			continue
+		}
 
-	weights := s.MovementWeights[finger-1]
-	return dx*weights.X + dy*weights.Y
+		idle[i] += 1
+		if returnHome > 0 && home[i] != -1 && idle[i] >= returnHome {
+			locations[i] = home[i]
+		}
+	}
 }
 
 func (s *Sequencer) ChooseOptimal(options []KeyPress) KeyPress {
@@ -206,8 +427,36 @@ func (s *Sequencer) ChooseOptimal(options []KeyPress) KeyPress {
 	return bestOption
 }
 
+func (s *Sequencer) shiftOptions(nextFinger int) []KeyPress {
+	s.Occupied[nextFinger] = KeyPress{}
+	defer delete(s.Occupied, nextFinger)
+
+	return s.filterPlayable(s.GetShiftKeys())
+}
+
+func (s *Sequencer) PressShift(shiftKey KeyPress) {
+	s.moveFinger(shiftKey)
+
+	if isOneShotMod(shiftKey.Val) {
+		s.OneShotShift = true
+		s.Sequence = append(s.Sequence, SequenceEvent{
+			Action:   "tap-oneshot-mod",
+			KeyPress: shiftKey,
+		})
+		return
+	}
+
+	s.Occupied[shiftKey.Finger] = shiftKey
+	s.Sequence = append(s.Sequence, SequenceEvent{
+		Action:   "press",
+		KeyPress: shiftKey,
+	})
+}
+
 func (s *Sequencer) ToggleShift(nextFinger int) {
-	if s.Shifted() {
+	if s.OneShotShift {
+		s.OneShotShift = false
+	} else if s.Shifted() {
 		finger, shiftKey := s.GetActiveShift()
 		delete(s.Occupied, finger)
 		s.Sequence = append(s.Sequence, SequenceEvent{
@@ -215,17 +464,7 @@ func (s *Sequencer) ToggleShift(nextFinger int) {
 			KeyPress: shiftKey,
 		})
 	} else {
-		s.Occupied[nextFinger] = KeyPress{}
-		defer delete(s.Occupied, nextFinger)
-
-		shiftOptions := s.GetShiftKeys()
-		chosen := s.ChooseOptimal(s.filterPlayable(shiftOptions))
-
-		s.Occupied[chosen.Finger] = chosen
-		s.Sequence = append(s.Sequence, SequenceEvent{
-			Action:   "press",
-			KeyPress: chosen,
-		})
+		s.PressShift(s.ChooseOptimal(s.shiftOptions(nextFinger)))
 	}
 }
 
@@ -234,8 +473,12 @@ func (s *Sequencer) AddEvent(event SequenceEvent) {
 }
 
 func (s *Sequencer) EventCanBePlayed(event SequenceEvent) bool {
-	if event.Action == "release" {
+	switch event.Action {
+	case "release":
 		return true
+	case "layer-release":
+		held, occupied := s.Occupied[event.Finger]
+		return occupied && held.Index == event.Index && held.Val == event.Val
 	}
 
 	_, occupied := s.Occupied[event.Finger]
@@ -246,7 +489,7 @@ func (s *Sequencer) PlayableEvents(events []SequenceEvent) []SequenceEvent {
 	playable := []SequenceEvent{}
 
 	for _, event := range events {
-		if s.EventCanBePlayed(event) || event.Action == "layer-release" {
+		if s.EventCanBePlayed(event) {
 			playable = append(playable, event)
 		}
 	}
@@ -259,15 +502,209 @@ func (s *Sequencer) AddKeyPress(keyPress KeyPress) {
 		s.ToggleShift(keyPress.Finger)
 	}
 
+	s.tapKey(keyPress)
+}
+
+func (s *Sequencer) tapKey(keyPress KeyPress) {
 	s.AddEvent(SequenceEvent{
 		Action:   "press",
 		KeyPress: keyPress,
 	})
+	s.moveFinger(keyPress)
 
 	s.AddEvent(SequenceEvent{
 		Action:   "release",
 		KeyPress: keyPress,
 	})
+
+	if s.OneShotLayer != -1 {
+		s.removeLayer(s.OneShotLayer)
+		s.OneShotLayer = -1
+	}
+
+	s.OneShotShift = false
+}
+
+// AddShortcut types val with the modifiers in mods held, e.g. ctrl+shift+z.
+// A key in the active layers that sends the whole shortcut by itself is
+// preferred over chording the modifier keys.
+func (s *Sequencer) AddShortcut(mods ModMask, val string) error {
+	direct := s.filterPlayable(s.InLayer(s.KeyFinder[Shortcut(mods, val)]))
+	if len(direct) > 0 {
+		s.AddKeyPress(s.ChooseOptimal(direct))
+		return nil
+	}
+
+	if finger, shiftKey := s.GetActiveShift(); finger != -1 {
+		delete(s.Occupied, finger)
+		s.AddEvent(SequenceEvent{
+			Action:   "release",
+			KeyPress: shiftKey,
+		})
+	}
+
+	targets := s.filterPlayable(s.InLayer(s.KeyFinder[val]))
+	if len(targets) == 0 {
+		return fmt.Errorf("could not find playable key for %s", val)
+	}
+	target := s.ChooseOptimal(targets)
+
+	// shift goes down last since CanBePlayed treats a held shift finger as free
+	names := []string{}
+	for _, mod := range mods.Names() {
+		if !strings.Contains(mod, "sft") {
+			names = append(names, mod)
+		}
+	}
+	for _, mod := range mods.Names() {
+		if strings.Contains(mod, "sft") {
+			names = append(names, mod)
+		}
+	}
+
+	s.Occupied[target.Finger] = KeyPress{}
+	held := []KeyPress{}
+	for _, mod := range names {
+		// a key holding several modifiers, like MEH_T, only has to be pressed once
+		alreadyHeld := slices.ContainsFunc(held, func(heldKey KeyPress) bool {
+			return slices.ContainsFunc(s.KeyFinder[mod], func(keyPress KeyPress) bool {
+				return keyPress.Index == heldKey.Index && keyPress.Layer == heldKey.Layer
+			})
+		})
+		if alreadyHeld {
+			continue
+		}
+
+		options := s.filterPlayable(s.InLayer(s.KeyFinder[mod]))
+		if len(options) == 0 {
+			delete(s.Occupied, target.Finger)
+			s.releaseKeys(held)
+			return fmt.Errorf("could not find playable key for modifier %s", mod)
+		}
+
+		modKey := s.ChooseOptimal(options)
+		s.Occupied[modKey.Finger] = modKey
+		s.moveFinger(modKey)
+		s.AddEvent(SequenceEvent{
+			Action:   "press",
+			KeyPress: modKey,
+		})
+		held = append(held, modKey)
+	}
+	delete(s.Occupied, target.Finger)
+
+	s.tapKey(target)
+	s.releaseKeys(held)
+
+	return nil
+}
+
+// AddCombo types val by chording one of its combos, changing layers first
+// if no combo can be played from the active ones.
+func (s *Sequencer) AddCombo(val string) error {
+	combos := s.Combos[val]
+	if len(combos) == 0 {
+		return fmt.Errorf("no combo sends %s", val)
+	}
+
+	for _, keys := range combos {
+		if s.comboPlayable(keys) {
+			s.pressCombo(keys)
+			return nil
+		}
+	}
+
+	for _, keys := range combos {
+		state := s.saveState()
+		err := s.DoLayerChange(keys[0].Layer, keys)
+		if err == nil && s.comboPlayable(keys) {
+			s.pressCombo(keys)
+			return nil
+		}
+		s.restoreState(state)
+	}
+
+	return fmt.Errorf("no combo for %s is playable", val)
+}
+
+func (s *Sequencer) comboPlayable(keys []KeyPress) bool {
+	return len(s.filterPlayable(s.InLayer(keys))) == len(keys)
+}
+
+func (s *Sequencer) comboCost(keys []KeyPress) float64 {
+	cost := 0.0
+	for _, keyPress := range keys {
+		cost += s.keyPressCost(keyPress)
+	}
+
+	return cost
+}
+
+// cheapestCombo returns the cheapest combo for val that can be chorded from
+// the active layers, along with its cost.
+func (s *Sequencer) cheapestCombo(val string) ([]KeyPress, float64, bool) {
+	var best []KeyPress
+	bestCost := 0.0
+
+	for _, keys := range s.Combos[val] {
+		if !s.comboPlayable(keys) {
+			continue
+		}
+
+		cost := s.comboCost(keys)
+		if best == nil || cost < bestCost {
+			best = keys
+			bestCost = cost
+		}
+	}
+
+	return best, bestCost, best != nil
+}
+
+// pressCombo presses every key of a combo before releasing any of them. Only
+// the first key is a "press", so the combo's output is typed once.
+func (s *Sequencer) pressCombo(keys []KeyPress) {
+	if s.Shifted() {
+		s.ToggleShift(keys[0].Finger)
+	}
+
+	for i, keyPress := range keys {
+		action := "press"
+		if i > 0 {
+			action = "press-combo"
+		}
+
+		s.AddEvent(SequenceEvent{
+			Action:   action,
+			KeyPress: keyPress,
+		})
+		s.moveFinger(keyPress)
+	}
+
+	for _, keyPress := range keys {
+		s.AddEvent(SequenceEvent{
+			Action:   "release",
+			KeyPress: keyPress,
+		})
+	}
+
+	if s.OneShotLayer != -1 {
+		s.removeLayer(s.OneShotLayer)
+		s.OneShotLayer = -1
+	}
+
+	s.OneShotShift = false
+}
+
+// releaseKeys releases held keys in the reverse order they were pressed.
+func (s *Sequencer) releaseKeys(held []KeyPress) {
+	for i := len(held) - 1; i >= 0; i-- {
+		delete(s.Occupied, held[i].Finger)
+		s.AddEvent(SequenceEvent{
+			Action:   "release",
+			KeyPress: held[i],
+		})
+	}
 }
 
 func (s *Sequencer) addToLayerChangeEvents(key string, event SequenceEvent) {
@@ -276,6 +713,10 @@ func (s *Sequencer) addToLayerChangeEvents(key string, event SequenceEvent) {
 		s.LayerChanges[key] = []SequenceEvent{}
 	}
 
+	if slices.Contains(s.LayerChanges[key], event) {
+		return
+	}
+
 	s.LayerChanges[key] = append(s.LayerChanges[key], event)
 }
 
@@ -295,138 +736,588 @@ func (s *Sequencer) CreateLayerChangeEvents() {
 				Action:   "press-layer-add",
 				KeyPress: keyPress,
 			})
+		case "TG":
+			current := keyPress.Layer
+			target, _ := strconv.Atoi(parts[1])
+			if current == target {
+				continue
+			}
+
+			s.addToLayerChangeEvents(fmt.Sprintf("%d-%d", current, target), SequenceEvent{
+				Action:   "tap-layer-toggle",
+				KeyPress: keyPress,
+			})
+
+			// toggling back off needs a TG for the same layer on the toggled layer
+			for _, offKey := range layerChanges {
+				if offKey.Val == keyPress.Val && offKey.Layer == target {
+					s.addToLayerChangeEvents(fmt.Sprintf("%d-%d", target, current), SequenceEvent{
+						Action:   "tap-layer-toggle",
+						KeyPress: offKey,
+					})
+				}
+			}
+		case "TO":
+			current := keyPress.Layer
+			target, _ := strconv.Atoi(parts[1])
 
-			keyPress.Layer = target
-			s.addToLayerChangeEvents(fmt.Sprintf("%d-%d", target, current), SequenceEvent{
-				Action:   "layer-release",
+			s.addToLayerChangeEvents(fmt.Sprintf("%d-%d", current, target), SequenceEvent{
+				Action:   "tap-layer-to",
+				KeyPress: keyPress,
+			})
+		case "DF":
+			current := keyPress.Layer
+			target, _ := strconv.Atoi(parts[1])
+
+			s.addToLayerChangeEvents(fmt.Sprintf("%d-%d", current, target), SequenceEvent{
+				Action:   "tap-layer-default",
+				KeyPress: keyPress,
+			})
+		case "OSL":
+			current := keyPress.Layer
+			target, _ := strconv.Atoi(parts[1])
+
+			s.addToLayerChangeEvents(fmt.Sprintf("%d-%d", current, target), SequenceEvent{
+				Action:   "tap-layer-oneshot",
 				KeyPress: keyPress,
 			})
 		default:
-			fmt.Printf("Unimplemented: %s\n", parts[0])
+			fmt.Printf("WARN: layer key '%s' is not supported, ignoring. (Results may be inaccurate)\n", keyPress.Val)
 		}
 	}
 }
 
 func (s *Sequencer) ApplyLayerChange(event SequenceEvent) {
+	if isKeyDown(event.Action) {
+		s.moveFinger(event.KeyPress)
+	}
+
 	switch event.Action {
 	case "press-layer-add":
 		s.Sequence = append(s.Sequence, event)
-		newLayer, _ := strconv.Atoi(strings.Split(event.Val, " ")[1])
-		s.LayerStack = append(s.LayerStack, newLayer)
+		s.LayerStack = append(s.LayerStack, layerTarget(event.Val))
 		s.Occupied[event.Finger] = event.KeyPress
 	case "layer-release":
 		s.Sequence = append(s.Sequence, event)
-		s.LayerStack = s.LayerStack[:len(s.LayerStack)-1]
+		s.removeLayer(layerTarget(event.Val))
 		delete(s.Occupied, event.Finger)
+	case "tap-layer-toggle":
+		s.Sequence = append(s.Sequence, event)
+		target := layerTarget(event.Val)
+		if slices.Contains(s.LayerStack[1:], target) {
+			s.removeLayer(target)
+		} else {
+			s.LayerStack = append(s.LayerStack, target)
+		}
+	case "tap-layer-to":
+		s.Sequence = append(s.Sequence, event)
+		s.releaseHeldLayers()
+		target := layerTarget(event.Val)
+		s.LayerStack = s.LayerStack[:1]
+		if target != s.LayerStack[0] {
+			s.LayerStack = append(s.LayerStack, target)
+		}
+	case "tap-layer-default":
+		s.Sequence = append(s.Sequence, event)
+		s.releaseHeldLayers()
+		s.ChangeDefaultLayer(layerTarget(event.Val))
+	case "tap-layer-oneshot":
+		s.Sequence = append(s.Sequence, event)
+		target := layerTarget(event.Val)
+		s.LayerStack = append(s.LayerStack, target)
+		s.OneShotLayer = target
 	}
 }
 
-// TODO: multi-event layerchanges
-// TODO: select from multiple options
-func (s *Sequencer) DoLayerChange(targetLayer int) {
-	singleEvents, ok := s.LayerChanges[fmt.Sprintf("%d-%d", s.ActiveLayer(), targetLayer)]
-	for !ok && len(s.LayerStack) > 1 {
-		s.DoLayerChange(s.LayerStack[len(s.LayerStack)-2])
-		singleEvents, ok = s.LayerChanges[fmt.Sprintf("%d-%d", s.ActiveLayer(), targetLayer)]
+const maxLayerPathLength = 4
+
+type LayerPath struct {
+	Events []SequenceEvent
+	Cost   float64
+}
+
+type sequencerState struct {
+	LayerStack   []int
+	Occupied     map[int]KeyPress
+	OneShotLayer int
+	OneShotShift bool
+	LastLocation [10]int
+	Idle         [10]int
+	SequenceLen  int
+}
+
+func (s *Sequencer) saveState() sequencerState {
+	occupied := make(map[int]KeyPress, len(s.Occupied))
+	for finger, keyPress := range s.Occupied {
+		occupied[finger] = keyPress
 	}
 
-	if !ok {
-		panic(fmt.Sprintf("could not find path to %d", targetLayer))
+	return sequencerState{
+		LayerStack:   slices.Clone(s.LayerStack),
+		Occupied:     occupied,
+		OneShotLayer: s.OneShotLayer,
+		OneShotShift: s.OneShotShift,
+		LastLocation: s.LastLocation,
+		Idle:         s.idle,
+		SequenceLen:  len(s.Sequence),
+	}
+}
+
+func (s *Sequencer) restoreState(state sequencerState) {
+	s.LayerStack = slices.Clone(state.LayerStack)
+	s.Occupied = make(map[int]KeyPress, len(state.Occupied))
+	for finger, keyPress := range state.Occupied {
+		s.Occupied[finger] = keyPress
+	}
+	s.OneShotLayer = state.OneShotLayer
+	s.OneShotShift = state.OneShotShift
+	s.LastLocation = state.LastLocation
+	s.idle = state.Idle
+	s.Sequence = s.Sequence[:state.SequenceLen]
+}
+
+func (s *Sequencer) layerStateKey() string {
+	fingers := []int{}
+	for finger := range s.Occupied {
+		fingers = append(fingers, finger)
 	}
+	sort.Ints(fingers)
 
-	playable := s.PlayableEvents(singleEvents)
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("%v|%d|%t|", s.LayerStack, s.OneShotLayer, s.OneShotShift))
+	for _, finger := range fingers {
+		builder.WriteString(fmt.Sprintf("%d:%d,", finger, s.Occupied[finger].Index))
+	}
 
-	s.ApplyLayerChange(playable[0])
+	return builder.String()
 }
 
-// TODO: implement this
-func (s *Sequencer) FindClosestLayer(options []int) int {
-	hasSingleEventLayerChange := []int{}
+// availableLayerEvents returns every layer change that can be played from the
+// current state, including the release of any held layer key.
+func (s *Sequencer) availableLayerEvents() []SequenceEvent {
+	keys := []string{}
+	for key := range s.LayerChanges {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-	for _, targetLayer := range options {
-		_, ok := s.LayerChanges[fmt.Sprintf("%d-%d", s.ActiveLayer(), targetLayer)]
-		if !ok {
-			continue
+	events := []SequenceEvent{}
+	for _, key := range keys {
+		for _, event := range s.PlayableEvents(s.LayerChanges[key]) {
+			if s.ResolvedLayer(event.Index) == event.Layer {
+				events = append(events, event)
+			}
 		}
+	}
 
-		if !slices.Contains(hasSingleEventLayerChange, targetLayer) {
-			hasSingleEventLayerChange = append(hasSingleEventLayerChange, targetLayer)
+	fingers := []int{}
+	for finger, keyPress := range s.Occupied {
+		if isLayerKey(keyPress.Val) {
+			fingers = append(fingers, finger)
 		}
 	}
+	sort.Ints(fingers)
 
-	if len(hasSingleEventLayerChange) > 0 {
-		return hasSingleEventLayerChange[0]
+	for _, finger := range fingers {
+		events = append(events, heldLayerRelease(s.Occupied[finger]))
 	}
 
-	return options[0]
+	return events
 }
 
-// TODO: add playable check to layer selection
-func (s *Sequencer) DoOptimalLayerChange(options []KeyPress) []KeyPress {
-	sortByLayer := make(map[int][]KeyPress)
-	layers := []int{}
+func (s *Sequencer) layerEventCost(event SequenceEvent) float64 {
+	if !isKeyDown(event.Action) {
+		return 1
+	}
 
-	for _, keyPress := range options {
-		_, ok := sortByLayer[keyPress.Layer]
-		if !ok {
-			sortByLayer[keyPress.Layer] = []KeyPress{}
+	return 1 + s.fingerMoveCost(event.Index, event.Finger)
+}
+
+// FindLayerPath searches the layer change events for the cheapest sequence
+// that makes targetLayer active while leaving at least one of options
+// playable. A nil options slice only requires the layer to be active.
+func (s *Sequencer) FindLayerPath(targetLayer int, options []KeyPress) (LayerPath, error) {
+	start := s.saveState()
+	defer s.restoreState(start)
+
+	targets := filterByLayer(options, targetLayer)
+	frontier := []LayerPath{{Events: []SequenceEvent{}}}
+	visited := make(map[string]bool)
+
+	for len(frontier) > 0 {
+		sort.SliceStable(frontier, func(i, j int) bool {
+			return frontier[i].Cost < frontier[j].Cost
+		})
+
+		current := frontier[0]
+		frontier = frontier[1:]
+
+		s.restoreState(start)
+		for _, event := range current.Events {
+			s.ApplyLayerChange(event)
+		}
+
+		key := s.layerStateKey()
+		if visited[key] {
+			continue
+		}
+		visited[key] = true
+
+		if options == nil && s.ActiveLayer() == targetLayer || options != nil && len(s.filterPlayable(targets)) > 0 {
+			return current, nil
 		}
 
-		sortByLayer[keyPress.Layer] = append(sortByLayer[keyPress.Layer], keyPress)
+		if len(current.Events) >= maxLayerPathLength {
+			continue
+		}
 
+		for _, event := range s.availableLayerEvents() {
+			frontier = append(frontier, LayerPath{
+				Events: append(slices.Clone(current.Events), event),
+				Cost:   current.Cost + s.layerEventCost(event),
+			})
+		}
+	}
+
+	return LayerPath{}, fmt.Errorf("could not find path to layer %d", targetLayer)
+}
+
+func (s *Sequencer) DoLayerChange(targetLayer int, options []KeyPress) error {
+	path, err := s.FindLayerPath(targetLayer, options)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range path.Events {
+		s.ApplyLayerChange(event)
+	}
+
+	return nil
+}
+
+func (s *Sequencer) FindClosestLayer(options []KeyPress) (int, error) {
+	layers := []int{}
+	for _, keyPress := range options {
 		if !slices.Contains(layers, keyPress.Layer) {
 			layers = append(layers, keyPress.Layer)
 		}
 	}
 
-	if len(layers) == 1 {
-		s.DoLayerChange(layers[0])
-		return sortByLayer[layers[0]]
+	closestLayer := -1
+	bestCost := math.Inf(1)
+
+	for _, layer := range layers {
+		path, err := s.FindLayerPath(layer, options)
+		if err != nil {
+			continue
+		}
+
+		if path.Cost < bestCost {
+			bestCost = path.Cost
+			closestLayer = layer
+		}
+	}
+
+	if closestLayer == -1 {
+		return closestLayer, fmt.Errorf("could not find path to any of layers %v", layers)
+	}
+
+	return closestLayer, nil
+}
+
+func (s *Sequencer) DoOptimalLayerChange(options []KeyPress) ([]KeyPress, error) {
+	closestLayer, err := s.FindClosestLayer(options)
+	if err != nil {
+		return []KeyPress{}, err
+	}
+
+	err = s.DoLayerChange(closestLayer, options)
+	if err != nil {
+		return []KeyPress{}, err
 	}
 
-	closestLayer := s.FindClosestLayer(layers)
-	s.DoLayerChange(closestLayer)
-	return sortByLayer[closestLayer]
+	return filterByLayer(options, closestLayer), nil
+}
+
+func (s *Sequencer) findMatches(r rune) (string, []KeyPress, bool) {
+	targetString := string(r)
+	remapped, ok := Remap[targetString]
+	if ok {
+		targetString = remapped
+	}
+
+	allMatches, ok := s.KeyFinder[targetString]
+	if !ok && len(s.Combos[targetString]) == 0 {
+		fmt.Printf("WARN: Could not find '%s' in keyboard, skipping. (Results may be inaccurate)\n", targetString)
+	}
+
+	return targetString, allMatches, ok
+}
+
+func (s *Sequencer) releaseOccupied() {
+	fingers := []int{}
+	for finger := range s.Occupied {
+		fingers = append(fingers, finger)
+	}
+	sort.Ints(fingers)
+
+	for _, finger := range fingers {
+		s.Sequence = append(s.Sequence, SequenceEvent{
+			Action:   "release",
+			KeyPress: s.Occupied[finger],
+		})
+	}
 }
 
 func (s *Sequencer) Build(text string) error {
 	s.Reset(true)
+	s.characters = len([]rune(text))
 
-	for _, rune := range []rune(text) {
-		targetString := string(rune)
-		remapped, ok := Remap[targetString]
-		if ok {
-			targetString = remapped
-		}
+	if s.Mode == LookaheadMode {
+		return s.buildLookahead(text)
+	}
 
-		allMatches, ok := s.KeyFinder[targetString]
+	for _, rune := range []rune(text) {
+		targetString, allMatches, ok := s.findMatches(rune)
 		if !ok {
-			fmt.Printf("WARN: Could not find '%s' in keyboard, skipping. (Results may be inaccurate)\n", targetString)
+			if len(s.Combos[targetString]) > 0 {
+				err := s.AddCombo(targetString)
+				if err != nil {
+					fmt.Printf("WARN: '%s' found but %s, skipping. (Results may be inaccurate)\n", targetString, err.Error())
+				}
+			}
 			continue
 		}
 
-		inLayer := s.InLayer(allMatches)
-		if len(inLayer) == 0 {
-			inLayer = s.DoOptimalLayerChange(allMatches)
+		playable := s.filterPlayable(s.InLayer(allMatches))
+		if len(playable) == 0 {
+			// chording a combo on the active layers beats changing layers
+			if combo, _, ok := s.cheapestCombo(targetString); ok {
+				s.pressCombo(combo)
+				continue
+			}
+
+			inLayer, err := s.DoOptimalLayerChange(allMatches)
+			if err != nil {
+				fmt.Printf("WARN: '%s' found but %s, skipping. (Results may be inaccurate)\n", targetString, err.Error())
+				continue
+			}
+
+			playable = s.filterPlayable(inLayer)
 		}
 
-		playable := s.filterPlayable(inLayer)
 		if len(playable) == 0 {
 			fmt.Printf("WARN: '%s' found but not playable due to occupied fingers: %+v, skipping. (Results may be inaccurate)\n", targetString, s.Occupied)
 			continue
 		}
 
+		// a combo competes with the keys it could stand in for
 		optimal := s.ChooseOptimal(playable)
+		if combo, cost, ok := s.cheapestCombo(targetString); ok && cost < s.keyPressCost(optimal) {
+			s.pressCombo(combo)
+			continue
+		}
+
 		s.AddKeyPress(optimal)
 	}
 
-	for _, keyPress := range s.Occupied {
-		s.Sequence = append(s.Sequence, SequenceEvent{
-			Action:   "release",
-			KeyPress: keyPress,
+	s.releaseOccupied()
+
+	return nil
+}
+
+type beamNode struct {
+	parent *beamNode
+	events []SequenceEvent
+	state  sequencerState
+	key    string
+	cost   float64
+}
+
+func (n *beamNode) sequence() []SequenceEvent {
+	chunks := [][]SequenceEvent{}
+	for node := n; node != nil; node = node.parent {
+		chunks = append(chunks, node.events)
+	}
+
+	sequence := []SequenceEvent{}
+	for i := len(chunks) - 1; i >= 0; i-- {
+		sequence = append(sequence, chunks[i]...)
+	}
+
+	return sequence
+}
+
+func (s *Sequencer) keyPressCost(keyPress KeyPress) float64 {
+	cost := s.fingerMoveCost(keyPress.Index, keyPress.Finger)
+	if keyPress.Shifted != s.Shifted() {
+		cost += 1
+	}
+
+	return cost
+}
+
+// expandBeamNode returns a child node for every way of typing one of options
+// from the state stored in node, including any layer changes needed first.
+func (s *Sequencer) expandBeamNode(node *beamNode, options []KeyPress) []*beamNode {
+	children := []*beamNode{}
+
+	layers := []int{}
+	for _, keyPress := range options {
+		if !slices.Contains(layers, keyPress.Layer) {
+			layers = append(layers, keyPress.Layer)
+		}
+	}
+
+	for _, layer := range layers {
+		s.restoreState(node.state)
+
+		path, err := s.FindLayerPath(layer, options)
+		if err != nil {
+			continue
+		}
+
+		for _, event := range path.Events {
+			s.ApplyLayerChange(event)
+		}
+		afterLayerChange := s.saveState()
+
+		for _, keyPress := range s.filterPlayable(filterByLayer(options, layer)) {
+			s.restoreState(afterLayerChange)
+
+			// a capital can be typed with any of the available shift keys, held or one-shot
+			shiftChoices := []*KeyPress{nil}
+			if keyPress.Shifted && !s.Shifted() {
+				shiftChoices = []*KeyPress{}
+				for _, shiftKey := range s.shiftOptions(keyPress.Finger) {
+					shiftChoices = append(shiftChoices, &shiftKey)
+				}
+			}
+
+			for _, shiftKey := range shiftChoices {
+				s.restoreState(afterLayerChange)
+
+				cost := node.cost + path.Cost
+				if shiftKey != nil {
+					cost += 1 + s.fingerMoveCost(shiftKey.Index, shiftKey.Finger)
+					s.PressShift(*shiftKey)
+				}
+
+				cost += s.keyPressCost(keyPress)
+				s.AddKeyPress(keyPress)
+
+				state := s.saveState()
+				state.SequenceLen = 0
+
+				children = append(children, &beamNode{
+					parent: node,
+					events: slices.Clone(s.Sequence),
+					state:  state,
+					key:    fmt.Sprintf("%s%v", s.layerStateKey(), s.LastLocation),
+					cost:   cost,
+				})
+			}
+		}
+	}
+
+	return children
+}
+
+// expandComboNode returns a child node for every combo that can type val
+// from the state stored in node, including any layer changes needed first.
+func (s *Sequencer) expandComboNode(node *beamNode, val string) []*beamNode {
+	children := []*beamNode{}
+
+	for _, keys := range s.Combos[val] {
+		s.restoreState(node.state)
+
+		path, err := s.FindLayerPath(keys[0].Layer, keys)
+		if err != nil {
+			continue
+		}
+
+		for _, event := range path.Events {
+			s.ApplyLayerChange(event)
+		}
+
+		if !s.comboPlayable(keys) {
+			continue
+		}
+
+		cost := node.cost + path.Cost + s.comboCost(keys)
+		s.pressCombo(keys)
+
+		state := s.saveState()
+		state.SequenceLen = 0
+
+		children = append(children, &beamNode{
+			parent: node,
+			events: slices.Clone(s.Sequence),
+			state:  state,
+			key:    fmt.Sprintf("%s%v", s.layerStateKey(), s.LastLocation),
+			cost:   cost,
 		})
 	}
 
+	return children
+}
+
+// buildLookahead keeps the BeamWidth cheapest partial sequences at every
+// character instead of committing to the locally cheapest key, so a choice
+// that costs more now can win if it makes the following characters cheaper.
+func (s *Sequencer) buildLookahead(text string) error {
+	start := s.saveState()
+	beam := []*beamNode{{state: start}}
+
+	beamWidth := max(s.BeamWidth, 1)
+
+	for _, rune := range []rune(text) {
+		targetString, allMatches, ok := s.findMatches(rune)
+		if !ok && len(s.Combos[targetString]) == 0 {
+			continue
+		}
+
+		// keys and combos are scored against each other
+		candidates := []*beamNode{}
+		for _, node := range beam {
+			if ok {
+				candidates = append(candidates, s.expandBeamNode(node, allMatches)...)
+			}
+			candidates = append(candidates, s.expandComboNode(node, targetString)...)
+		}
+
+		if len(candidates) == 0 {
+			fmt.Printf("WARN: '%s' found but not reachable or playable, skipping. (Results may be inaccurate)\n", targetString)
+			continue
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].cost < candidates[j].cost
+		})
+
+		seen := make(map[string]bool)
+		beam = []*beamNode{}
+		for _, candidate := range candidates {
+			if seen[candidate.key] {
+				continue
+			}
+			seen[candidate.key] = true
+
+			beam = append(beam, candidate)
+			if len(beam) == beamWidth {
+				break
+			}
+		}
+	}
+
+	best := beam[0]
+	s.Sequence = []SequenceEvent{}
+	best.state.SequenceLen = 0
+	s.restoreState(best.state)
+	s.Sequence = best.sequence()
+
+	s.releaseOccupied()
+
 	return nil
 }
 
@@ -462,113 +1353,186 @@ type Position struct {
 	Y float64
 }
 
+// EuclideanDistance is the distance between the centers of two keys, in
+// keyboard units.
 func EuclideanDistance(p1, p2 KeyPosition) float64 {
-	return math.Sqrt(math.Pow(p2.X-p1.X, 2) + math.Pow(p2.Y-p1.Y, 2))
+	x1, y1 := p1.Center()
+	x2, y2 := p2.Center()
+
+	return math.Sqrt(math.Pow(x2-x1, 2) + math.Pow(y2-y1, 2))
 }
 
-func (s *Sequencer) Analyze(includeRepeated bool) AnalysisData {
-	data := AnalysisData{}
-	SFBs := make(map[string]int)
+const (
+	// lateralStretchDistance is how far apart, in keyboard units, the keys of
+	// an index and middle finger bigram are once the index leaves its column.
+	lateralStretchDistance = 1.5
+	// halfScissorRows and fullScissorRows are how far apart vertically, in
+	// keyboard units, the keys of adjacent fingers are one and two rows apart.
+	halfScissorRows = 0.5
+	fullScissorRows = 1.5
+)
 
-	lastFinger := -1
-	lastVal := ""
+const (
+	pinkyFinger = iota
+	ringFinger
+	middleFinger
+	indexFinger
+	thumbFinger
+)
 
-	s.Reset(false)
+// fingerReach ranks the fingers of a hand by length, so scissors can tell
+// which finger has to curl under the other.
+var fingerReach = [5]int{pinkyFinger: 0, ringFinger: 2, middleFinger: 3, indexFinger: 1, thumbFinger: 0}
 
-	for _, event := range s.Sequence {
-		if event.Action == "release" {
-			continue
-		}
+// fingerHand splits a fingermap finger, 1-5 for the left hand and 6-10 for
+// the right, into its hand and which finger of the hand it is.
+func fingerHand(finger int) (int, int) {
+	return (finger - 1) / 5, (finger - 1) % 5
+}
 
-		if strings.Contains(event.Action, "layer") {
-			data.LayerSwitches += 1
-			if !strings.Contains(event.Action, "press") {
-				continue
-			}
-		}
+// adjacentFingers reports whether two fingers are neighbours on the same
+// hand, leaving out the thumbs.
+func adjacentFingers(f1, f2 int) bool {
+	hand1, finger1 := fingerHand(f1)
+	hand2, finger2 := fingerHand(f2)
+	if hand1 != hand2 || finger1 == thumbFinger || finger2 == thumbFinger {
+		return false
+	}
 
-		layer := event.Layer
-		for len(data.LayerCounts) < layer+1 {
-			data.LayerCounts = append(data.LayerCounts, 0)
-		}
-		data.LayerCounts[layer] += 1
+	return finger1-finger2 == 1 || finger2-finger1 == 1
+}
 
-		if strings.Contains(event.Action, "press") {
-			lastLocation := s.LastLocation[event.Finger-1]
-			if lastLocation != -1 {
-				p1 := s.Layout[lastLocation]
-				p2 := s.Layout[event.Index]
+// IsLateralStretch reports whether pressing p1 with finger f1 and then p2
+// with f2 has the index reach into the inner column next to the middle finger.
+func IsLateralStretch(f1 int, p1 KeyPosition, f2 int, p2 KeyPosition) bool {
+	if !adjacentFingers(f1, f2) {
+		return false
+	}
 
-				data.FingerTravel[event.Finger-1] += EuclideanDistance(p1, p2) * 19.05
-			}
+	_, finger1 := fingerHand(f1)
+	_, finger2 := fingerHand(f2)
+	if finger1 != indexFinger && finger2 != indexFinger {
+		return false
+	}
 
-			s.LastLocation[event.Finger-1] = event.Index
-			data.FingerCounts[event.Finger-1] += 1
-		}
+	x1, _ := p1.Center()
+	x2, _ := p2.Center()
 
-		if lastFinger == event.Finger && (lastVal != event.Val || includeRepeated) {
-			builder := strings.Builder{}
-			if len(lastVal) > 1 {
-				builder.WriteString(fmt.Sprintf("<%s>", lastVal))
-			} else {
-				builder.WriteString(lastVal)
-			}
+	return math.Abs(x2-x1) >= lateralStretchDistance
+}
 
-			if len(event.Val) > 1 {
-				builder.WriteString(fmt.Sprintf("<%s>", event.Val))
-			} else {
-				builder.WriteString(event.Val)
-			}
+// ScissorKind tells full scissors, adjacent fingers on keys two rows apart,
+// from half scissors, where they are one row apart with the longer finger
+// on the lower key.
+type ScissorKind int
 
-			key := builder.String()
-			_, ok := SFBs[key]
-			if !ok {
-				SFBs[key] = 0
-			}
-			SFBs[key] += 1
+const (
+	NoScissor ScissorKind = iota
+	HalfScissor
+	FullScissor
+)
+
+// Scissor classifies pressing p1 with finger f1 and then p2 with f2.
+func Scissor(f1 int, p1 KeyPosition, f2 int, p2 KeyPosition) ScissorKind {
+	if !adjacentFingers(f1, f2) {
+		return NoScissor
+	}
 
-			data.SFBTotal += 1
-			data.SFBFingerCounts[event.Finger-1] += 1
+	_, y1 := p1.Center()
+	_, y2 := p2.Center()
+	rows := y2 - y1
+
+	switch {
+	case math.Abs(rows) >= fullScissorRows:
+		return FullScissor
+	case math.Abs(rows) >= halfScissorRows:
+		_, finger1 := fingerHand(f1)
+		_, finger2 := fingerHand(f2)
+		if (fingerReach[finger2] > fingerReach[finger1]) == (rows > 0) {
+			return HalfScissor
 		}
+	}
+
+	return NoScissor
+}
 
-		lastFinger = event.Finger
-		lastVal = event.Val
+// pressLabel joins the values of consecutive key presses, wrapping the ones
+// longer than a character so the sequence stays readable.
+func pressLabel(vals ...string) string {
+	builder := strings.Builder{}
+	for _, val := range vals {
+		if len(val) > 1 {
+			builder.WriteString(fmt.Sprintf("<%s>", val))
+		} else {
+			builder.WriteString(val)
+		}
 	}
 
+	return builder.String()
+}
+
+// countEntries lists counts from most to least common.
+func countEntries(counts map[string]int) []CountEntry {
 	keys := []string{}
-	for key := range SFBs {
+	for key := range counts {
 		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
 	sort.SliceStable(keys, func(i, j int) bool {
-		return SFBs[keys[i]] > SFBs[keys[j]]
+		return counts[keys[i]] > counts[keys[j]]
 	})
 
+	entries := []CountEntry{}
 	for _, key := range keys {
-		data.SFBCounts = append(data.SFBCounts, CountEntry{
+		entries = append(entries, CountEntry{
 			Label: key,
-			Value: SFBs[key],
+			Value: counts[key],
 		})
 	}
 
-	for i := range data.FingerTravel {
-		data.FingerTravel[i] = math.Round(data.FingerTravel[i])
-		data.TotalTravel += data.FingerTravel[i]
+	return entries
+}
+
+// Analyze runs every registered metric over the built sequence and scores
+// them with the default scoring profile.
+func (s *Sequencer) Analyze(includeRepeated bool) AnalysisData {
+	infos := RegisteredMetrics()
+	metrics := []Metric{}
+	for _, info := range infos {
+		metrics = append(metrics, info.New(s, includeRepeated))
 	}
 
-	data.TotalTravel = math.Round(data.TotalTravel / 1000)
-	data.LayersUsed = len(data.LayerCounts)
+	for _, event := range s.Sequence {
+		for _, metric := range metrics {
+			metric.Observe(event)
+		}
+	}
+
+	data := AnalysisData{Characters: s.characters}
+	for i, metric := range metrics {
+		result := metric.Finalize()
+		result.Name = infos[i].Name
+		if result.Title == "" {
+			result.Title = infos[i].Title
+		}
+		data.Metrics = append(data.Metrics, result)
+	}
 
-	data.Score = math.Round(float64(data.SFBTotal)/4 + float64(data.LayerSwitches)/8 + data.TotalTravel)
+	data.Score = DefaultScoringProfile.Score(data)
+	data.ScoringProfile = DefaultScoringProfile.Name
 
 	return data
 }
 
+func isKeyDown(action string) bool {
+	return strings.Contains(action, "press") || strings.Contains(action, "tap")
+}
+
 func (s *Sequencer) InLayer(options []KeyPress) []KeyPress {
 	inLayer := []KeyPress{}
-	targetLayer := s.ActiveLayer()
 	for _, keyPress := range options {
-		if targetLayer == keyPress.Layer {
+		if s.ResolvedLayer(keyPress.Index) == keyPress.Layer {
 			inLayer = append(inLayer, keyPress)
 		}
 	}
@@ -602,15 +1566,35 @@ func CreateKeyfinder(layers [][]KC, fingermap Fingermap) (KeyFinder, error) {
 		for keyIndex := range len(fingermap.Keys) {
 			kc := layers[layer][keyIndex]
 
-			keyfinder.AddKey(kc.Default, KeyPress{
+			if kc.Kind == OneShotModKeycode {
+				keyfinder.AddKey(kc.Default, KeyPress{
+					Finger: fingermap.Keys[keyIndex],
+					Index:  keyIndex,
+					Layer:  layer,
+					Val:    kc.Default,
+				})
+				continue
+			}
+
+			if kc.Default == "TRANS" {
+				keyfinder.AddKey("<trans>", KeyPress{
+					Finger: fingermap.Keys[keyIndex],
+					Index:  keyIndex,
+					Layer:  layer,
+					Val:    kc.Default,
+				})
+				continue
+			}
+
+			keyfinder.AddKey(kc.Output(), KeyPress{
 				Finger:  fingermap.Keys[keyIndex],
 				Index:   keyIndex,
 				Layer:   layer,
 				Shifted: false,
-				Val:     kc.Default,
+				Val:     kc.Output(),
 			})
 
-			if kc.Shift != "" {
+			if kc.Shift != "" && kc.Mods == 0 {
 				keyfinder.AddKey(kc.Shift, KeyPress{
 					Finger:  fingermap.Keys[keyIndex],
 					Index:   keyIndex,
@@ -620,27 +1604,84 @@ func CreateKeyfinder(layers [][]KC, fingermap Fingermap) (KeyFinder, error) {
 				})
 			}
 
-			if kc.Hold != "" {
-				targetKey := kc.Hold
-				keyPress := KeyPress{
+			if isLayerKey(kc.Hold) {
+				keyfinder.AddKey("<layer>", KeyPress{
+					Finger:  fingermap.Keys[keyIndex],
+					Index:   keyIndex,
+					Layer:   layer,
+					Shifted: false,
+					Val:     kc.Hold,
+				})
+			}
+
+			for _, mod := range kc.HoldMods.Names() {
+				keyfinder.AddKey(mod, KeyPress{
 					Finger:  fingermap.Keys[keyIndex],
 					Index:   keyIndex,
 					Layer:   layer,
 					Shifted: false,
+					Val:     mod,
+				})
+			}
+		}
+	}
+
+	return keyfinder, nil
+}
+
+// CreateCombos finds the keys of every combo in the keymap, on each layer
+// that has all of them.
+func CreateCombos(keymap KeymapData, fingermap Fingermap) (ComboFinder, error) {
+	combos := make(ComboFinder)
+	if len(keymap.Combos) == 0 {
+		return combos, nil
+	}
+
+	table, err := GetKeycodeTable(keymap.KeycodeVersion)
+	if err != nil {
+		return combos, err
+	}
+
+	for _, combo := range keymap.Combos {
+		output, err := ParseLayerWithKeycodes([]string{combo.Output}, table)
+		if err != nil {
+			return combos, err
+		}
+		val := output[0].Output()
+
+		for layer, keys := range keymap.Layers {
+			if len(combo.Layers) > 0 && !slices.Contains(combo.Layers, layer) {
+				continue
+			}
+
+			indexes := combo.Positions
+			if len(indexes) == 0 {
+				indexes = []int{}
+				for _, key := range combo.Keys {
+					indexes = append(indexes, slices.Index(keys, key))
 				}
+			}
 
-				parts := strings.Split(kc.Hold, " ")
-				if len(parts) == 1 {
-					keyPress.Val = kc.Hold
-				} else {
-					targetKey = "<layer>"
-					keyPress.Val = kc.Hold
+			presses := []KeyPress{}
+			for _, index := range indexes {
+				if index < 0 || index >= len(fingermap.Keys) {
+					presses = nil
+					break
 				}
 
-				keyfinder.AddKey(targetKey, keyPress)
+				presses = append(presses, KeyPress{
+					Finger: fingermap.Keys[index],
+					Index:  index,
+					Layer:  layer,
+					Val:    val,
+				})
+			}
+
+			if len(presses) > 0 {
+				combos[val] = append(combos[val], presses)
 			}
 		}
 	}
 
-	return keyfinder, nil
+	return combos, nil
 }
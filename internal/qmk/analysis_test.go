@@ -1,15 +1,21 @@
 package qmk
 
 import (
+	"errors"
+	"math"
 	"path"
 	"testing"
 )
 
 func GetSequencer(t *testing.T) *Sequencer {
+	return GetSequencerForKeymap(t, "ferris_sweep_test.json")
+}
+
+func GetSequencerForKeymap(t *testing.T, keymapName string) *Sequencer {
 	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
 	NoError(t, err)
 
-	keymap, err := q.GetKeymapData(path.Join(q.KeymapDir, "LAYOUT_split_3x5_2/ferris_sweep_test.json"))
+	keymap, err := q.GetKeymapData(path.Join(q.KeymapDir, "LAYOUT_split_3x5_2", keymapName))
 	NoError(t, err)
 
 	layers, err := keymap.ParseLayers()
@@ -24,7 +30,11 @@ func GetSequencer(t *testing.T) *Sequencer {
 	keyfinder, err := CreateKeyfinder(layers, fingermap)
 	NoError(t, err)
 
-	return NewSequencer(keyfinder, layout)
+	sequencer := NewSequencer(keyfinder, layout)
+	sequencer.MovementWeights = fingermap.MovementWeights()
+	sequencer.Home = fingermap.HomeKeys()
+
+	return sequencer
 }
 
 func TestBuildWord(t *testing.T) {
@@ -303,15 +313,15 @@ func TestAnalysis(t *testing.T) {
 	sequencer.Build(text)
 
 	analysis := sequencer.Analyze(false)
-	Equal(t, 0, analysis.SFBTotal)
+	Equal(t, 0.0, analysis.Value("sfb"))
 
 	analysis = sequencer.Analyze(true)
-	Equal(t, 1, analysis.SFBTotal)
+	Equal(t, 1.0, analysis.Value("sfb"))
 
-	expectedFingerCounts := [10]int{0, 0, 1, 0, 0, 0, 0, 0, 0, 0}
-	for i := range 10 {
-		Equal(t, expectedFingerCounts[i], analysis.SFBFingerCounts[i])
-	}
+	expectedFingerCounts := []float64{0, 0, 1, 0, 0, 0, 0, 0, 0, 0}
+	byFinger, ok := analysis.Table("sfb", "By Finger")
+	Equal(t, true, ok)
+	ArrayEqual(t, expectedFingerCounts, byFinger.Fingers)
 }
 
 func TestFullSentence(t *testing.T) {
@@ -328,7 +338,8 @@ func TestFullSentence(t *testing.T) {
 		Value: 1,
 	}
 	analysis := sequencer.Analyze(true)
-	ArrayContains(t, expected, analysis.SFBCounts)
+	byBigram, _ := analysis.Table("sfb", "By Bigram")
+	ArrayContains(t, expected, byBigram.Entries)
 }
 
 func TestLayerChangeLT(t *testing.T) {
@@ -425,7 +436,7 @@ func TestLayerChangeLT(t *testing.T) {
 	ArrayEqual(t, expected, sequencer.Sequence)
 
 	analysis := sequencer.Analyze(false)
-	Equal(t, 2, analysis.LayerSwitches)
+	Equal(t, 2.0, analysis.Value("layer_switches"))
 }
 
 func TestFingerDistance(t *testing.T) {
@@ -438,6 +449,1197 @@ func TestFingerDistance(t *testing.T) {
 	Equal(t, text, sequencer.String(true))
 
 	analysis := sequencer.Analyze(true)
-	Equal(t, 38, analysis.FingerTravel[3])
-	Equal(t, 3, analysis.FingerCounts[3])
+	travel, _ := analysis.Table("travel", "By Finger")
+	Equal(t, 38.0, travel.Fingers[3])
+	Equal(t, 0.0381, math.Round(analysis.Value("travel")*10000)/10000)
+	presses, _ := analysis.Table("fingers", "By Finger")
+	Equal(t, 3.0, presses.Fingers[3])
+}
+
+func TestMovementCost(t *testing.T) {
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	fingermap, err := q.LoadFingermapFromJSON("./test_content/movement/ferris_index_reach.hjson")
+	NoError(t, err)
+
+	// directions left out keep their default cost
+	weights := fingermap.MovementWeights()
+	Equal(t, MovementCost{Inward: 2, Outward: 1, Up: 1, Down: 1}, weights[3])
+	Equal(t, DefaultMovementCost, weights[1])
+
+	sequencer := GetSequencer(t)
+	sequencer.Build("tgt")
+	travel, _ := sequencer.Analyze(false).Table("travel", "By Finger")
+	Equal(t, 38.0, travel.Fingers[3])
+
+	// the reach into the inner column costs double on the way in only
+	sequencer.MovementWeights = weights
+	travel, _ = sequencer.Analyze(false).Table("travel", "By Finger")
+	Equal(t, 57.0, travel.Fingers[3])
+
+	// from t, m is a row up and g a column in
+	g := KeyPress{Finger: 4, Index: 14, Val: "g"}
+	m := KeyPress{Finger: 4, Index: 3, Val: "m"}
+
+	sequencer = GetSequencer(t)
+	sequencer.LastLocation[3] = 13
+	Equal(t, m, sequencer.ChooseOptimal([]KeyPress{g, m}))
+
+	sequencer.MovementWeights[3] = MovementCost{Inward: 1, Outward: 1, Up: 3, Down: 1}
+	Equal(t, g, sequencer.ChooseOptimal([]KeyPress{m, g}))
+
+	sequencer.MovementWeights[3] = MovementCost{Inward: 1, Outward: 1, Up: 1, Down: 3}
+	Equal(t, m, sequencer.ChooseOptimal([]KeyPress{g, m}))
+
+	_, err = q.LoadFingermapFromJSON("./test_content/movement/short.json")
+	ErrorEqual(t, errors.New("./test_content/movement/short.json: movement needs 10 fingers, got 2"), err)
+}
+
+func TestHomeKeys(t *testing.T) {
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	fingermap, err := q.LoadFingermapFromJSON("./test_content/home/ferris_home.json")
+	NoError(t, err)
+
+	sequencer := GetSequencer(t)
+
+	// without home keys the first press of a finger is free
+	sequencer.Build("dsrsd")
+	analysis := sequencer.Analyze(false)
+	travel, _ := analysis.Table("travel", "By Finger")
+	Equal(t, 0.0, travel.Fingers[3])
+	Equal(t, 0.0, analysis.Value("off_home"))
+
+	// the index starts on t, reaches down to d once and stays there
+	sequencer.Home = fingermap.HomeKeys()
+	sequencer.Build("dsrsd")
+	analysis = sequencer.Analyze(false)
+	travel, _ = analysis.Table("travel", "By Finger")
+	Equal(t, 19.0, travel.Fingers[3])
+
+	offHome, _ := analysis.Table("home", "By Finger")
+	ArrayEqual(t, []float64{0, 0, 0, 100, 0, 0, 0, 0, 0, 0}, offHome.Fingers)
+	Equal(t, 10.0, analysis.Value("off_home"))
+
+	// three presses by other fingers send it back home in between
+	sequencer.ReturnHome = 3
+	sequencer.Build("dsrsd")
+	analysis = sequencer.Analyze(false)
+	travel, _ = analysis.Table("travel", "By Finger")
+	Equal(t, 38.0, travel.Fingers[3])
+
+	offHome, _ = analysis.Table("home", "By Finger")
+	Equal(t, 80.0, offHome.Fingers[3])
+	Equal(t, 8.0, analysis.Value("off_home"))
+
+	// key choice starts from home too
+	sequencer.Reset(true)
+	Equal(t, 13, sequencer.LastLocation[3])
+
+	_, err = q.LoadFingermapFromJSON("./test_content/home/wrong_finger.json")
+	ErrorEqual(t, errors.New("./test_content/home/wrong_finger.json: home key 15 of finger 4 is pressed by finger 9"), err)
+}
+
+func TestStretchesAndScissors(t *testing.T) {
+	sequencer := GetSequencer(t)
+
+	text := "wl jc gr mr ys"
+
+	sequencer.Build(text)
+
+	Equal(t, text, sequencer.String(true))
+
+	analysis := sequencer.Analyze(true)
+
+	// g is on the index's inner column, two columns from r on the middle finger
+	Equal(t, 1.0, analysis.Value("lateral_stretch"))
+	stretches, _ := analysis.Table("stretches", "Lateral Stretch Bigrams")
+	ArrayEqual(t, []CountEntry{{Label: "gr", Value: 1}}, stretches.Entries)
+
+	// w and j are on the bottom row, two rows below l and c
+	Equal(t, 2.0, analysis.Value("scissor"))
+	scissors, _ := analysis.Table("stretches", "Full Scissors")
+	ArrayEqual(t, []CountEntry{{Label: "jc", Value: 1}, {Label: "wl", Value: 1}}, scissors.Entries)
+
+	// the middle and ring fingers reach lower than the index and pinky
+	Equal(t, 2.0, analysis.Value("half_scissor"))
+	halfScissors, _ := analysis.Table("stretches", "Half Scissors")
+	ArrayEqual(t, []CountEntry{{Label: "mr", Value: 1}, {Label: "ys", Value: 1}}, halfScissors.Entries)
+}
+
+func TestSkipgrams(t *testing.T) {
+	sequencer := GetSequencer(t)
+
+	text := "sic ctaw"
+	sequencer.Build(text)
+	Equal(t, text, sequencer.String(true))
+
+	ArrayEqual(t, []float64{1, 0.5, 0.25}, sequencer.SkipgramWeights)
+
+	// s and c share the left ring finger with the pinky in between, c and w
+	// have two keys in between
+	analysis := sequencer.Analyze(false)
+	pairs, _ := analysis.Table("skipgrams", "By Key Pair")
+	ArrayEqual(t, []CountEntry{{Label: "cw", Value: 1}, {Label: "sc", Value: 1}}, pairs.Entries)
+	distances, _ := analysis.Table("skipgrams", "By Distance")
+	ArrayEqual(t, []CountEntry{{Label: "1 between", Value: 1}, {Label: "2 between", Value: 1}, {Label: "3 between", Value: 0}}, distances.Entries)
+	fingers, _ := analysis.Table("skipgrams", "By Finger")
+	Equal(t, 1.5, fingers.Fingers[1])
+	Equal(t, 1.5, analysis.Value("skipgram"))
+
+	// the repeated c is left out unless asked for, like same finger bigrams
+	analysis = sequencer.Analyze(true)
+	distances, _ = analysis.Table("skipgrams", "By Distance")
+	Equal(t, 2, distances.Entries[0].Value)
+	Equal(t, 2.5, analysis.Value("skipgram"))
+
+	sequencer.SkipgramWeights = SkipgramWeights(1, 0.5)
+	analysis = sequencer.Analyze(false)
+	pairs, _ = analysis.Table("skipgrams", "By Key Pair")
+	ArrayEqual(t, []CountEntry{{Label: "sc", Value: 1}}, pairs.Entries)
+	Equal(t, 1.0, analysis.Value("skipgram"))
+}
+
+func TestScissorDirection(t *testing.T) {
+	top := KeyPosition{X: 1, Y: 0}
+	home := KeyPosition{X: 2, Y: 1}
+
+	// left ring finger on top, then the middle finger a row lower
+	Equal(t, HalfScissor, Scissor(2, top, 3, home))
+	// the middle finger on top with the ring finger lower is comfortable
+	Equal(t, NoScissor, Scissor(3, top, 2, home))
+	// the right hand mirrors the left
+	Equal(t, HalfScissor, Scissor(7, top, 8, home))
+	// fingers of different hands or thumbs never scissor
+	Equal(t, NoScissor, Scissor(4, top, 9, home))
+	Equal(t, NoScissor, Scissor(4, top, 5, KeyPosition{X: 2, Y: 3}))
+
+	Equal(t, true, IsLateralStretch(4, KeyPosition{X: 4}, 3, KeyPosition{X: 2}))
+	Equal(t, false, IsLateralStretch(4, KeyPosition{X: 3}, 3, KeyPosition{X: 2}))
+	Equal(t, false, IsLateralStretch(2, KeyPosition{X: 4}, 3, KeyPosition{X: 2}))
+}
+
+func TestLayerChangeTG(t *testing.T) {
+	sequencer := GetSequencerForKeymap(t, "layer_change_test.json")
+
+	text := "a[b"
+	sequencer.Build(text)
+
+	Equal(t, text, sequencer.String(true))
+
+	expected := []SequenceEvent{
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "tap-layer-toggle",
+			KeyPress: KeyPress{
+				Finger:  4,
+				Index:   24,
+				Layer:   0,
+				Shifted: false,
+				Val:     "TG 3",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   3,
+				Shifted: false,
+				Val:     "[",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   3,
+				Shifted: false,
+				Val:     "[",
+			},
+		},
+		{
+			Action: "tap-layer-toggle",
+			KeyPress: KeyPress{
+				Finger:  4,
+				Index:   24,
+				Layer:   3,
+				Shifted: false,
+				Val:     "TG 3",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   25,
+				Layer:   0,
+				Shifted: false,
+				Val:     "b",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   25,
+				Layer:   0,
+				Shifted: false,
+				Val:     "b",
+			},
+		},
+	}
+
+	ArrayEqual(t, expected, sequencer.Sequence)
+
+	analysis := sequencer.Analyze(false)
+	Equal(t, 2.0, analysis.Value("layer_switches"))
+}
+
+func TestLayerChangeTO(t *testing.T) {
+	sequencer := GetSequencerForKeymap(t, "layer_change_test.json")
+
+	text := "a-b"
+	sequencer.Build(text)
+
+	Equal(t, text, sequencer.String(true))
+
+	expected := []SequenceEvent{
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "tap-layer-to",
+			KeyPress: KeyPress{
+				Finger:  4,
+				Index:   14,
+				Layer:   0,
+				Shifted: false,
+				Val:     "TO 5",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   5,
+				Shifted: false,
+				Val:     "-",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   5,
+				Shifted: false,
+				Val:     "-",
+			},
+		},
+		{
+			Action: "tap-layer-to",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   20,
+				Layer:   5,
+				Shifted: false,
+				Val:     "TO 0",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   25,
+				Layer:   0,
+				Shifted: false,
+				Val:     "b",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   25,
+				Layer:   0,
+				Shifted: false,
+				Val:     "b",
+			},
+		},
+	}
+
+	ArrayEqual(t, expected, sequencer.Sequence)
+
+	analysis := sequencer.Analyze(false)
+	Equal(t, 2.0, analysis.Value("layer_switches"))
+}
+
+func TestLayerChangeOSL(t *testing.T) {
+	sequencer := GetSequencerForKeymap(t, "layer_change_test.json")
+
+	text := "a|b"
+	sequencer.Build(text)
+
+	Equal(t, text, sequencer.String(true))
+
+	expected := []SequenceEvent{
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "tap-layer-oneshot",
+			KeyPress: KeyPress{
+				Finger:  10,
+				Index:   33,
+				Layer:   0,
+				Shifted: false,
+				Val:     "OSL 2",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   2,
+				Shifted: false,
+				Val:     "|",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   2,
+				Shifted: false,
+				Val:     "|",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   25,
+				Layer:   0,
+				Shifted: false,
+				Val:     "b",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   25,
+				Layer:   0,
+				Shifted: false,
+				Val:     "b",
+			},
+		},
+	}
+
+	ArrayEqual(t, expected, sequencer.Sequence)
+	ArrayEqual(t, []int{0}, sequencer.LayerStack)
+
+	analysis := sequencer.Analyze(false)
+	Equal(t, 1.0, analysis.Value("layer_switches"))
+}
+
+func TestLayerChangeDF(t *testing.T) {
+	sequencer := GetSequencerForKeymap(t, "layer_change_test.json")
+
+	text := "aqa"
+	sequencer.Build(text)
+
+	Equal(t, text, sequencer.String(true))
+
+	expected := []SequenceEvent{
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "tap-layer-default",
+			KeyPress: KeyPress{
+				Finger:  6,
+				Index:   29,
+				Layer:   0,
+				Shifted: false,
+				Val:     "DF 4",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   0,
+				Layer:   4,
+				Shifted: false,
+				Val:     "q",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   0,
+				Layer:   4,
+				Shifted: false,
+				Val:     "q",
+			},
+		},
+		{
+			Action: "tap-layer-default",
+			KeyPress: KeyPress{
+				Finger:  6,
+				Index:   29,
+				Layer:   4,
+				Shifted: false,
+				Val:     "DF 0",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+	}
+
+	ArrayEqual(t, expected, sequencer.Sequence)
+
+	analysis := sequencer.Analyze(false)
+	Equal(t, 2.0, analysis.Value("layer_switches"))
+}
+
+func TestLayerChangeMultiHop(t *testing.T) {
+	sequencer := GetSequencerForKeymap(t, "multi_hop_test.json")
+
+	text := "a[b"
+	sequencer.Build(text)
+
+	Equal(t, text, sequencer.String(true))
+
+	expected := []SequenceEvent{
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "press-layer-add",
+			KeyPress: KeyPress{
+				Finger:  10,
+				Index:   32,
+				Layer:   0,
+				Shifted: false,
+				Val:     "LT 1",
+			},
+		},
+		{
+			Action: "press-layer-add",
+			KeyPress: KeyPress{
+				Finger:  5,
+				Index:   30,
+				Layer:   1,
+				Shifted: false,
+				Val:     "MO 3",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   3,
+				Shifted: false,
+				Val:     "[",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   3,
+				Shifted: false,
+				Val:     "[",
+			},
+		},
+		{
+			Action: "layer-release",
+			KeyPress: KeyPress{
+				Finger:  5,
+				Index:   30,
+				Layer:   3,
+				Shifted: false,
+				Val:     "MO 3",
+			},
+		},
+		{
+			Action: "layer-release",
+			KeyPress: KeyPress{
+				Finger:  10,
+				Index:   32,
+				Layer:   1,
+				Shifted: false,
+				Val:     "LT 1",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   25,
+				Layer:   0,
+				Shifted: false,
+				Val:     "b",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   25,
+				Layer:   0,
+				Shifted: false,
+				Val:     "b",
+			},
+		},
+	}
+
+	ArrayEqual(t, expected, sequencer.Sequence)
+
+	analysis := sequencer.Analyze(false)
+	Equal(t, 4.0, analysis.Value("layer_switches"))
+}
+
+func TestLayerChangeUnreachable(t *testing.T) {
+	sequencer := GetSequencerForKeymap(t, "multi_hop_test.json")
+
+	err := sequencer.DoLayerChange(4, nil)
+	ErrorEqual(t, errors.New("could not find path to layer 4"), err)
+	ArrayEqual(t, []int{0}, sequencer.LayerStack)
+
+	text := "a=b"
+	sequencer.Build(text)
+	Equal(t, "ab", sequencer.String(true))
+}
+
+func TestLookaheadStaysOnLayer(t *testing.T) {
+	text := "5|"
+
+	greedy := GetSequencerForKeymap(t, "multi_hop_test.json")
+	greedy.Build(text)
+	Equal(t, text, greedy.String(true))
+	Equal(t, 2.0, greedy.Analyze(false).Value("layer_switches"))
+
+	lookahead := GetSequencerForKeymap(t, "multi_hop_test.json")
+	lookahead.Mode = LookaheadMode
+	lookahead.Build(text)
+	Equal(t, text, lookahead.String(true))
+
+	expected := []SequenceEvent{
+		{
+			Action: "press-layer-add",
+			KeyPress: KeyPress{
+				Finger:  5,
+				Index:   31,
+				Layer:   0,
+				Shifted: false,
+				Val:     "MO 2",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  3,
+				Index:   12,
+				Layer:   2,
+				Shifted: false,
+				Val:     "5",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  3,
+				Index:   12,
+				Layer:   2,
+				Shifted: false,
+				Val:     "5",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   2,
+				Shifted: false,
+				Val:     "|",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   2,
+				Shifted: false,
+				Val:     "|",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  5,
+				Index:   31,
+				Layer:   0,
+				Shifted: false,
+				Val:     "MO 2",
+			},
+		},
+	}
+
+	ArrayEqual(t, expected, lookahead.Sequence)
+	Equal(t, 1.0, lookahead.Analyze(false).Value("layer_switches"))
+}
+
+func TestLookaheadMatchesGreedy(t *testing.T) {
+	text := "Hello, my name is James."
+
+	greedy := GetSequencer(t)
+	greedy.Build(text)
+
+	lookahead := GetSequencer(t)
+	lookahead.Mode = LookaheadMode
+	lookahead.Build(text)
+
+	Equal(t, text, lookahead.String(true))
+	ArrayEqual(t, greedy.Sequence, lookahead.Sequence)
+}
+
+func TestTransparentFallthrough(t *testing.T) {
+	sequencer := GetSequencerForKeymap(t, "layer_change_test.json")
+
+	_, ok := sequencer.KeyFinder["TRANS"]
+	Equal(t, false, ok)
+
+	text := "a[a"
+	sequencer.Build(text)
+
+	Equal(t, text, sequencer.String(true))
+
+	expected := []SequenceEvent{
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "tap-layer-toggle",
+			KeyPress: KeyPress{
+				Finger:  4,
+				Index:   24,
+				Layer:   0,
+				Shifted: false,
+				Val:     "TG 3",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   3,
+				Shifted: false,
+				Val:     "[",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   3,
+				Shifted: false,
+				Val:     "[",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+	}
+
+	ArrayEqual(t, expected, sequencer.Sequence)
+	Equal(t, 1.0, sequencer.Analyze(false).Value("layer_switches"))
+}
+
+func TestTransparentShiftOnHeldLayer(t *testing.T) {
+	sequencer := GetSequencer(t)
+
+	text := "a!"
+	sequencer.Build(text)
+
+	Equal(t, text, sequencer.String(true))
+
+	expected := []SequenceEvent{
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  7,
+				Index:   18,
+				Layer:   0,
+				Shifted: false,
+				Val:     "a",
+			},
+		},
+		{
+			Action: "press-layer-add",
+			KeyPress: KeyPress{
+				Finger:  10,
+				Index:   32,
+				Layer:   0,
+				Shifted: false,
+				Val:     "LT 1",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  5,
+				Index:   30,
+				Layer:   0,
+				Shifted: false,
+				Val:     "lsft",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   26,
+				Layer:   1,
+				Shifted: true,
+				Val:     "!",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   26,
+				Layer:   1,
+				Shifted: true,
+				Val:     "!",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  5,
+				Index:   30,
+				Layer:   0,
+				Shifted: false,
+				Val:     "lsft",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  10,
+				Index:   32,
+				Layer:   0,
+				Shifted: false,
+				Val:     "LT 1",
+			},
+		},
+	}
+
+	ArrayEqual(t, expected, sequencer.Sequence)
+}
+
+func TestOneShotShift(t *testing.T) {
+	sequencer := GetSequencerForKeymap(t, "osm_test.json")
+
+	text := "Hi"
+	sequencer.Build(text)
+
+	Equal(t, text, sequencer.String(true))
+
+	expected := []SequenceEvent{
+		{
+			Action: "tap-oneshot-mod",
+			KeyPress: KeyPress{
+				Finger:  10,
+				Index:   33,
+				Layer:   0,
+				Shifted: false,
+				Val:     "OSM lsft",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   26,
+				Layer:   0,
+				Shifted: true,
+				Val:     "H",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   26,
+				Layer:   0,
+				Shifted: true,
+				Val:     "H",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   0,
+				Shifted: false,
+				Val:     "i",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   0,
+				Shifted: false,
+				Val:     "i",
+			},
+		},
+	}
+
+	ArrayEqual(t, expected, sequencer.Sequence)
+	Equal(t, false, sequencer.Shifted())
+}
+
+func TestOneShotShiftLookaheadHoldsShift(t *testing.T) {
+	// a held shift is cheaper than tapping the one-shot key before each capital
+	sequencer := GetSequencerForKeymap(t, "osm_test.json")
+	sequencer.Mode = LookaheadMode
+
+	text := "HI"
+	sequencer.Build(text)
+
+	Equal(t, text, sequencer.String(true))
+
+	expected := []SequenceEvent{
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  5,
+				Index:   30,
+				Layer:   0,
+				Shifted: false,
+				Val:     "lsft",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   26,
+				Layer:   0,
+				Shifted: true,
+				Val:     "H",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   26,
+				Layer:   0,
+				Shifted: true,
+				Val:     "H",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   0,
+				Shifted: true,
+				Val:     "I",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  1,
+				Index:   10,
+				Layer:   0,
+				Shifted: true,
+				Val:     "I",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  5,
+				Index:   30,
+				Layer:   0,
+				Shifted: false,
+				Val:     "lsft",
+			},
+		},
+	}
+
+	ArrayEqual(t, expected, sequencer.Sequence)
+}
+
+func TestShortcut(t *testing.T) {
+	sequencer := GetSequencerForKeymap(t, "shortcut_test.json")
+
+	// ctrl+x has its own key, ctrl+shift+z is chorded from the mod-tap and shift keys
+	NoError(t, sequencer.AddShortcut(ModLCtl, "x"))
+	NoError(t, sequencer.AddShortcut(ModLCtl|ModLSft, "z"))
+
+	expected := []SequenceEvent{
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  4,
+				Index:   4,
+				Layer:   0,
+				Shifted: false,
+				Val:     "lctl+x",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  4,
+				Index:   4,
+				Layer:   0,
+				Shifted: false,
+				Val:     "lctl+x",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  5,
+				Index:   30,
+				Layer:   0,
+				Shifted: false,
+				Val:     "lctl",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  10,
+				Index:   33,
+				Layer:   0,
+				Shifted: false,
+				Val:     "lsft",
+			},
+		},
+		{
+			Action: "press",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   5,
+				Layer:   0,
+				Shifted: false,
+				Val:     "z",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  9,
+				Index:   5,
+				Layer:   0,
+				Shifted: false,
+				Val:     "z",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  10,
+				Index:   33,
+				Layer:   0,
+				Shifted: false,
+				Val:     "lsft",
+			},
+		},
+		{
+			Action: "release",
+			KeyPress: KeyPress{
+				Finger:  5,
+				Index:   30,
+				Layer:   0,
+				Shifted: false,
+				Val:     "lctl",
+			},
+		},
+	}
+
+	ArrayEqual(t, expected, sequencer.Sequence)
+	Equal(t, 0, len(sequencer.Occupied))
+
+	err := sequencer.AddShortcut(ModLAlt, "z")
+	ErrorEqual(t, errors.New("could not find playable key for modifier lalt"), err)
+	Equal(t, 0, len(sequencer.Occupied))
 }
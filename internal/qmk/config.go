@@ -0,0 +1,102 @@
+package qmk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hjson/hjson-go/v4"
+)
+
+// hjsonErrorRegex splits the position off the end of hjson errors, which read
+// like "Found '}' where a key name was expected at line 3,1 >>> }".
+var hjsonErrorRegex = regexp.MustCompile(`(?s)^(.*) at line (\d+),(\d+) >>> `)
+
+// DecodeConfig decodes a layout, keymap or fingermap file into v. Files are
+// usually plain JSON, but hand edited ones may hold comments, trailing commas
+// or other HJSON syntax, so anything encoding/json rejects as malformed is
+// read again as HJSON. Errors point at the line and column of the problem.
+func DecodeConfig(b []byte, v any) error {
+	err := json.Unmarshal(b, v)
+	if err == nil {
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		line, col := lineColumn(b, valueStart(b, typeErr.Offset))
+		return fmt.Errorf("line %d, column %d: %s", line, col, typeErrorMessage(typeErr))
+	}
+
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+
+	err = hjson.Unmarshal(b, v)
+	if err == nil {
+		return nil
+	}
+
+	// hjson hands its result to encoding/json, whose offsets don't match the file
+	if errors.As(err, &typeErr) {
+		return errors.New(typeErrorMessage(typeErr))
+	}
+
+	match := hjsonErrorRegex.FindStringSubmatch(err.Error())
+	if match != nil {
+		return fmt.Errorf("line %s, column %s: %s", match[2], match[3], match[1])
+	}
+
+	// hjson only leaves the position out when it ran off the end of the file
+	line, col := lineColumn(b, int64(len(b)))
+	return fmt.Errorf("line %d, column %d: %w", line, col, err)
+}
+
+func typeErrorMessage(err *json.UnmarshalTypeError) string {
+	field := err.Field
+	if field == "" {
+		field = "value"
+	}
+
+	return fmt.Sprintf("%s should be %s, got %s", field, err.Type, err.Value)
+}
+
+// lineColumn converts a byte offset into a 1-based line and column.
+func lineColumn(b []byte, offset int64) (int, int) {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+
+	before := b[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+
+	return line, col
+}
+
+// valueStart moves the offset of a JSON type error, which points just past
+// the offending value, back to where a string or literal value starts.
+func valueStart(b []byte, offset int64) int64 {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+
+	if offset > 0 && b[offset-1] == '"' {
+		for offset--; offset > 0; offset-- {
+			if b[offset-1] == '"' && (offset < 2 || b[offset-2] != '\\') {
+				return offset - 1
+			}
+		}
+		return offset
+	}
+
+	for offset > 0 && !strings.ContainsRune(",:[{ \t\r\n", rune(b[offset-1])) {
+		offset--
+	}
+
+	return offset
+}
@@ -0,0 +1,59 @@
+package qmk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoadHJSONFiles(t *testing.T) {
+	keymap := KeymapData{}
+	err := LoadKeymapFromJSON("./test_content/hjson/ferris_sweep_test.json", &keymap)
+	NoError(t, err)
+
+	expected := KeymapData{}
+	err = LoadKeymapFromJSON("./test_content/keymaps/LAYOUT_split_3x5_2/ferris_sweep_test.json", &expected)
+	NoError(t, err)
+
+	Equal(t, expected.Layout, keymap.Layout)
+	Equal(t, len(expected.Layers), len(keymap.Layers))
+	for i := range expected.Layers {
+		ArrayEqual(t, expected.Layers[i], keymap.Layers[i])
+	}
+
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	fingermap, err := q.LoadFingermapFromJSON("./test_content/hjson/fingermap.json")
+	NoError(t, err)
+
+	expectedFingermap, err := q.LoadFingermapFromJSON("./test_content/fingermaps/LAYOUT_split_3x5_2/ferris_sweep_test.json")
+	NoError(t, err)
+	ArrayEqual(t, expectedFingermap.Keys, fingermap.Keys)
+
+	layoutData := LayoutData{}
+	err = LoadLayoutFromJSON("./test_content/hjson/LAYOUT_tiny_raw.json", &layoutData)
+	NoError(t, err)
+
+	Equal(t, "tiny raw", layoutData.KeyboardName)
+	layout := layoutData.Layout["LAYOUT_tiny_raw"]["layout"]
+	Equal(t, 4, len(layout))
+	Equal(t, 2.0, layout[1].X)
+	Equal(t, 1.5, layout[2].W)
+	ArrayEqual(t, []int{1, 1}, layout[3].Matrix)
+}
+
+func TestDecodeConfigErrors(t *testing.T) {
+	keymap := KeymapData{}
+
+	err := DecodeConfig([]byte("{\n\t\"keymap\": \"test\",\n\t\"layers\": \"KC_A\"\n}"), &keymap)
+	ErrorEqual(t, errors.New("line 3, column 12: layers should be [][]string, got string"), err)
+
+	err = DecodeConfig([]byte("{\n\t\"keymap\": \"test\",\n\t\"layers\": [[\"KC_A\"]]\n"), &keymap)
+	ErrorEqual(t, errors.New("line 4, column 1: End of input while parsing an object (did you forget a closing '}'?)"), err)
+
+	err = DecodeConfig([]byte("{\n\t// no value\n\t\"keymap\":\n}"), &keymap)
+	ErrorEqual(t, errors.New("line 4, column 1: Found a punctuator character '}' when expecting a quoteless string (check your syntax)"), err)
+
+	Equal(t, true, IsKLE([]byte("/* raw data */\n# from kle\n[[\"0,0\"]]")))
+	Equal(t, false, IsKLE([]byte("// info.json\n{\"layouts\": {}}")))
+}
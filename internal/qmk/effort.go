@@ -0,0 +1,408 @@
+package qmk
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// effortRowGap is how far apart in keyboard units the centers of two keys
+// have to be to sit in different columns, and how far a key has to be from
+// its neighbour in the next column to sit on a different row, leaving room
+// for column stagger.
+const effortRowGap = 0.5
+
+// EffortModel estimates the effort of typing like Carpalx does. Every three
+// consecutive key presses, a triad, cost
+//
+//	base_weight * k1*b1 * (1 + k2*b2 * (1 + k3*b3))
+//	+ penalty_weight * k1*p1 * (1 + k2*p2 * (1 + k3*p3))
+//	+ stroke_weight * s
+//
+// where b is the base effort of each key, p the penalty of the hand, row and
+// finger pressing it and s the penalty of the path the triad strokes. The
+// reported effort is the average over all triads.
+type EffortModel struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// K weighs the first, second and third key of a triad.
+	K             []float64 `json:"k"`
+	BaseWeight    float64   `json:"base_weight"`
+	PenaltyWeight float64   `json:"penalty_weight"`
+	StrokeWeight  float64   `json:"stroke_weight"`
+	// BaseEffort is the effort of pressing each key, by row of the layout
+	// from the top and by key of the row from the left. Keys outside the
+	// grid cost DefaultBaseEffort.
+	BaseEffort        [][]float64          `json:"base_effort"`
+	DefaultBaseEffort float64              `json:"default_base_effort"`
+	Penalties         EffortPenaltyWeights `json:"penalties"`
+	// HandPenalties are for the left and right hand.
+	HandPenalties []float64 `json:"hand_penalties"`
+	// RowPenalties are by row of the layout from the top, rows past the end
+	// have none.
+	RowPenalties []float64 `json:"row_penalties"`
+	// FingerPenalties are in fingermap order from the left pinky to the
+	// right thumb.
+	FingerPenalties []float64           `json:"finger_penalties"`
+	Stroke          EffortStrokeWeights `json:"stroke"`
+}
+
+// EffortPenaltyWeights weighs the parts of a key's penalty, Base is added to
+// every key.
+type EffortPenaltyWeights struct {
+	Base   float64 `json:"base"`
+	Hand   float64 `json:"hand"`
+	Row    float64 `json:"row"`
+	Finger float64 `json:"finger"`
+}
+
+// EffortStrokeWeights weighs the parts of a triad's stroke path penalty:
+// whether it alternates hands, how it moves between rows and whether its
+// fingers roll in one direction.
+type EffortStrokeWeights struct {
+	Hand   float64 `json:"hand"`
+	Row    float64 `json:"row"`
+	Finger float64 `json:"finger"`
+}
+
+// DefaultEffortModel has the parameters Carpalx settled on, with a base effort
+// grid for three rows of five keys a hand, the inner index column being a
+// reach, and thumb keys below them.
+var DefaultEffortModel = EffortModel{
+	Name:          "carpalx",
+	Description:   "Carpalx parameters with a base effort grid for 3x5 keys a hand and thumb keys",
+	K:             []float64{1, 0.367, 0.235},
+	BaseWeight:    0.3555,
+	PenaltyWeight: 0.6423,
+	StrokeWeight:  0.4268,
+	BaseEffort: [][]float64{
+		{2, 2, 2, 2, 2.5, 2.5, 2, 2, 2, 2},
+		{0, 0, 0, 0, 2, 2, 0, 0, 0, 0},
+		{2, 2, 2, 2, 3.5, 3.5, 2, 2, 2, 2},
+		{0, 0, 0, 0},
+	},
+	DefaultBaseEffort: 2,
+	Penalties:         EffortPenaltyWeights{Base: 0, Hand: 1, Row: 1.3088, Finger: 2.5948},
+	HandPenalties:     []float64{0, 0},
+	RowPenalties:      []float64{0.5, 0, 1, 0},
+	FingerPenalties:   []float64{1, 0.5, 0, 0, 0, 1, 0.5, 0, 0, 0},
+	Stroke:            EffortStrokeWeights{Hand: 1, Row: 0.3, Finger: 0.3},
+}
+
+// clone copies the model so decoding into it leaves the original's slices
+// alone.
+func (m EffortModel) clone() EffortModel {
+	m.K = slices.Clone(m.K)
+	m.HandPenalties = slices.Clone(m.HandPenalties)
+	m.RowPenalties = slices.Clone(m.RowPenalties)
+	m.FingerPenalties = slices.Clone(m.FingerPenalties)
+
+	grid := make([][]float64, len(m.BaseEffort))
+	for i, row := range m.BaseEffort {
+		grid[i] = slices.Clone(row)
+	}
+	m.BaseEffort = grid
+
+	return m
+}
+
+func (m EffortModel) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("effort model has no name")
+	}
+
+	if len(m.K) != 3 {
+		return fmt.Errorf("effort model %s: k needs 3 weights, got %d", m.Name, len(m.K))
+	}
+
+	if len(m.HandPenalties) != 2 {
+		return fmt.Errorf("effort model %s: hand_penalties needs 2 hands, got %d", m.Name, len(m.HandPenalties))
+	}
+
+	if len(m.FingerPenalties) != 10 {
+		return fmt.Errorf("effort model %s: finger_penalties needs 10 fingers, got %d", m.Name, len(m.FingerPenalties))
+	}
+
+	return nil
+}
+
+// ParseEffortModel reads a model from JSON or HJSON, see DecodeConfig. Any
+// parameter left out keeps its value from DefaultEffortModel, and models
+// without a name are called name.
+func ParseEffortModel(b []byte, name string) (EffortModel, error) {
+	model := DefaultEffortModel.clone()
+	model.Name = ""
+	model.Description = ""
+
+	err := DecodeConfig(b, &model)
+	if err != nil {
+		return model, err
+	}
+
+	if model.Name == "" {
+		model.Name = name
+	}
+
+	return model, model.Validate()
+}
+
+// LoadEffortModel reads a model from a file, named after the file unless it
+// names itself.
+func LoadEffortModel(filePath string) (EffortModel, error) {
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return EffortModel{}, err
+	}
+
+	model, err := ParseEffortModel(b, strings.TrimSuffix(path.Base(filePath), path.Ext(filePath)))
+	if err != nil {
+		return model, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	return model, nil
+}
+
+// LayoutGrid places every key of a layout in a row, counted from the top, and
+// a column of that row, counted from the left. Keys are grouped into columns
+// by their centers, and rows are followed from one column to the next, so
+// rows stay together however far the columns are staggered.
+func LayoutGrid(layout Layout) ([]int, []int) {
+	rows := make([]int, len(layout))
+	cols := make([]int, len(layout))
+	if len(layout) == 0 {
+		return rows, cols
+	}
+
+	xs := make([]float64, len(layout))
+	ys := make([]float64, len(layout))
+	order := make([]int, len(layout))
+	for i, key := range layout {
+		xs[i], ys[i] = key.Center()
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return xs[order[a]] < xs[order[b]]
+	})
+
+	columns := [][]int{{order[0]}}
+	for i := 1; i < len(order); i++ {
+		if xs[order[i]]-xs[order[i-1]] >= effortRowGap {
+			columns = append(columns, []int{})
+		}
+		columns[len(columns)-1] = append(columns[len(columns)-1], order[i])
+	}
+
+	// the top key of each column takes the row of the closest key in the
+	// column before, shifted by how many rows lower it is, and every key
+	// below it is at least a row further down
+	top := 0
+	for c, column := range columns {
+		sort.SliceStable(column, func(a, b int) bool {
+			return ys[column[a]] < ys[column[b]]
+		})
+
+		if c > 0 {
+			closest := columns[c-1][0]
+			for _, key := range columns[c-1] {
+				if math.Abs(ys[key]-ys[column[0]]) < math.Abs(ys[closest]-ys[column[0]]) {
+					closest = key
+				}
+			}
+			rows[column[0]] = rows[closest] + int(math.Round(ys[column[0]]-ys[closest]))
+		}
+
+		for i := 1; i < len(column); i++ {
+			rows[column[i]] = rows[column[i-1]] + max(1, int(math.Round(ys[column[i]]-ys[column[i-1]])))
+		}
+
+		top = min(top, rows[column[0]])
+	}
+
+	// keys are still in order from the left, so each row counts its columns
+	counts := map[int]int{}
+	for _, key := range order {
+		rows[key] -= top
+		cols[key] = counts[rows[key]]
+		counts[rows[key]] += 1
+	}
+
+	return rows, cols
+}
+
+// baseEffort is the effort of the key at row and col.
+func (m EffortModel) baseEffort(row, col int) float64 {
+	if row < len(m.BaseEffort) && col < len(m.BaseEffort[row]) {
+		return m.BaseEffort[row][col]
+	}
+
+	return m.DefaultBaseEffort
+}
+
+// penalty is the penalty of pressing a key on row with a fingermap finger.
+func (m EffortModel) penalty(row, finger int) float64 {
+	hand, _ := fingerHand(finger)
+
+	rowPenalty := 0.0
+	if row < len(m.RowPenalties) {
+		rowPenalty = m.RowPenalties[row]
+	}
+
+	return m.Penalties.Base +
+		m.Penalties.Hand*m.HandPenalties[hand] +
+		m.Penalties.Row*rowPenalty +
+		m.Penalties.Finger*m.FingerPenalties[finger-1]
+}
+
+// triadEffort combines the efforts of three keys, the first weighing most.
+func (m EffortModel) triadEffort(e1, e2, e3 float64) float64 {
+	return m.K[0] * e1 * (1 + m.K[1]*e2*(1+m.K[2]*e3))
+}
+
+// fingerColumn numbers the fingers from left to right across the keyboard,
+// the right hand being mirrored in the fingermap.
+func fingerColumn(finger int) int {
+	if finger > 5 {
+		return 15 - finger
+	}
+
+	return finger - 1
+}
+
+// handStroke is 0 for a triad alternating hands, 1 when two keys in a row
+// are on one hand and 2 when all three are.
+func handStroke(f1, f2, f3 int) int {
+	hand1, _ := fingerHand(f1)
+	hand2, _ := fingerHand(f2)
+	hand3, _ := fingerHand(f3)
+
+	switch {
+	case hand1 == hand2 && hand2 == hand3:
+		return 2
+	case hand1 != hand2 && hand2 != hand3:
+		return 0
+	}
+
+	return 1
+}
+
+// rowStroke is 0 for a triad on one row, 1 when it moves in one direction
+// staying on a row once, 2 when it moves in one direction on every key and 3
+// when it changes direction.
+func rowStroke(r1, r2, r3 int) int {
+	d1, d2 := r2-r1, r3-r2
+
+	switch {
+	case d1 == 0 && d2 == 0:
+		return 0
+	case d1 == 0 || d2 == 0:
+		return 1
+	case (d1 > 0) == (d2 > 0):
+		return 2
+	}
+
+	return 3
+}
+
+// fingerStroke is 0 for a triad rolling across different fingers in one
+// direction, 1 when a key is pressed twice, 2 when the fingers change
+// direction and 3 when a finger presses two different keys in a row.
+func fingerStroke(e1, e2, e3 SequenceEvent) int {
+	if (e1.Finger == e2.Finger && e1.Index != e2.Index) || (e2.Finger == e3.Finger && e2.Index != e3.Index) {
+		return 3
+	}
+
+	if e1.Finger == e2.Finger || e2.Finger == e3.Finger {
+		return 1
+	}
+
+	c1, c2, c3 := fingerColumn(e1.Finger), fingerColumn(e2.Finger), fingerColumn(e3.Finger)
+	if (c2 > c1) == (c3 > c2) {
+		return 0
+	}
+
+	return 2
+}
+
+// effortMetric works out the effort of every three keys pressed on their
+// own in a row, the same triads trigrams are made of.
+type effortMetric struct {
+	model   EffortModel
+	rows    []int
+	cols    []int
+	presses []SequenceEvent
+	triads  int
+	base    float64
+	penalty float64
+	stroke  float64
+	fingers [10]float64
+}
+
+func newEffortMetric(model EffortModel, layout Layout) *effortMetric {
+	rows, cols := LayoutGrid(layout)
+
+	return &effortMetric{model: model, rows: rows, cols: cols}
+}
+
+func (m *effortMetric) Observe(event SequenceEvent) {
+	if !soloPress(event) {
+		return
+	}
+
+	base := m.model.baseEffort(m.rows[event.Index], m.cols[event.Index])
+	penalty := m.model.penalty(m.rows[event.Index], event.Finger)
+	m.fingers[event.Finger-1] += m.model.BaseWeight*base + m.model.PenaltyWeight*penalty
+
+	m.presses = append(m.presses, event)
+	if len(m.presses) < 3 {
+		return
+	}
+	if len(m.presses) > 3 {
+		m.presses = m.presses[1:]
+	}
+
+	bases := [3]float64{}
+	penalties := [3]float64{}
+	for i, press := range m.presses {
+		bases[i] = m.model.baseEffort(m.rows[press.Index], m.cols[press.Index])
+		penalties[i] = m.model.penalty(m.rows[press.Index], press.Finger)
+	}
+
+	e1, e2, e3 := m.presses[0], m.presses[1], m.presses[2]
+	stroke := m.model.Stroke.Hand*float64(handStroke(e1.Finger, e2.Finger, e3.Finger)) +
+		m.model.Stroke.Row*float64(rowStroke(m.rows[e1.Index], m.rows[e2.Index], m.rows[e3.Index])) +
+		m.model.Stroke.Finger*float64(fingerStroke(e1, e2, e3))
+
+	m.base += m.model.BaseWeight * m.model.triadEffort(bases[0], bases[1], bases[2])
+	m.penalty += m.model.PenaltyWeight * m.model.triadEffort(penalties[0], penalties[1], penalties[2])
+	m.stroke += m.model.StrokeWeight * stroke
+	m.triads += 1
+}
+
+func (m *effortMetric) Finalize() MetricResult {
+	average := func(total float64) float64 {
+		if m.triads == 0 {
+			return 0
+		}
+		return total / float64(m.triads)
+	}
+
+	for i := range m.fingers {
+		m.fingers[i] = math.Round(m.fingers[i]*100) / 100
+	}
+
+	return MetricResult{
+		Title: fmt.Sprintf("Effort (%s model)", m.model.Name),
+		Values: []MetricValue{
+			{Name: "effort", Label: "Effort Per Triad", Value: average(m.base + m.penalty + m.stroke)},
+			{Name: "effort_base", Label: "Base Effort", Value: average(m.base)},
+			{Name: "effort_penalty", Label: "Penalty Effort", Value: average(m.penalty)},
+			{Name: "effort_stroke", Label: "Stroke Path Effort", Value: average(m.stroke)},
+		},
+		Tables: []MetricTable{fingerTable("Key Effort By Finger", m.fingers, "")},
+	}
+}
@@ -0,0 +1,116 @@
+package qmk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLayoutGrid(t *testing.T) {
+	sequencer := GetSequencer(t)
+
+	rows, cols := LayoutGrid(sequencer.Layout)
+
+	// column stagger keeps each row of the ferris together, the thumbs below
+	ArrayEqual(t, []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 3, 3, 3}, rows)
+	ArrayEqual(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 1, 2, 3}, cols)
+}
+
+func TestLayoutGridPinkyStagger(t *testing.T) {
+	// three rows of five columns a hand, staggered like a kyria or sweep
+	// with a dropped pinky column, and two thumb keys a hand
+	stagger := []float64{0.7, 0.3, 0, 0.2, 0.35}
+	layout := Layout{}
+	for row := range 3 {
+		for col, offset := range stagger {
+			layout = append(layout, KeyPosition{X: float64(col), Y: float64(row) + offset})
+		}
+		for col := range stagger {
+			layout = append(layout, KeyPosition{X: float64(col + 7), Y: float64(row) + stagger[len(stagger)-col-1]})
+		}
+	}
+	layout = append(layout,
+		KeyPosition{X: 3.5, Y: 3.3}, KeyPosition{X: 4.5, Y: 3.5},
+		KeyPosition{X: 6.5, Y: 3.5}, KeyPosition{X: 7.5, Y: 3.3},
+	)
+
+	rows, cols := LayoutGrid(layout)
+
+	ArrayEqual(t, []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 3, 3, 3}, rows)
+	ArrayEqual(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 1, 2, 3}, cols)
+}
+
+func TestEffortStrokes(t *testing.T) {
+	Equal(t, 0, handStroke(2, 8, 3))
+	Equal(t, 1, handStroke(2, 3, 8))
+	Equal(t, 2, handStroke(2, 3, 4))
+
+	Equal(t, 0, rowStroke(1, 1, 1))
+	Equal(t, 1, rowStroke(0, 1, 1))
+	Equal(t, 2, rowStroke(2, 1, 0))
+	Equal(t, 3, rowStroke(1, 0, 1))
+
+	press := func(finger, index int) SequenceEvent {
+		return SequenceEvent{Action: "press", KeyPress: KeyPress{Finger: finger, Index: index}}
+	}
+
+	// rolling from the left ring finger towards the right
+	Equal(t, 0, fingerStroke(press(2, 11), press(3, 12), press(8, 17)))
+	// the right hand is mirrored, so pinky to ring rolls inwards
+	Equal(t, 0, fingerStroke(press(6, 19), press(7, 18), press(8, 17)))
+	Equal(t, 1, fingerStroke(press(2, 11), press(2, 11), press(3, 12)))
+	Equal(t, 2, fingerStroke(press(2, 11), press(3, 12), press(2, 11)))
+	Equal(t, 3, fingerStroke(press(2, 1), press(2, 11), press(3, 12)))
+}
+
+func TestEffortAnalysis(t *testing.T) {
+	sequencer := GetSequencer(t)
+
+	sequencer.Build("sre")
+	analysis := sequencer.Analyze(false)
+
+	// home row keys have no base effort, only the ring finger is penalized
+	// and the triad stays on one hand for two keys
+	Equal(t, 0.0, analysis.Value("effort_base"))
+	Equal(t, 0.833, round(analysis.Value("effort_penalty")))
+	Equal(t, 0.427, round(analysis.Value("effort_stroke")))
+	Equal(t, 1.26, round(analysis.Value("effort")))
+
+	byFinger, ok := analysis.Table("effort", "Key Effort By Finger")
+	Equal(t, true, ok)
+	ArrayEqual(t, []float64{0, 0.83, 0, 0, 0, 0, 0, 0, 0, 0}, byFinger.Fingers)
+
+	result, _ := analysis.Metric("effort")
+	Equal(t, "Effort (carpalx model)", result.Title)
+
+	model, err := LoadEffortModel("./test_content/effort/no_strokes.hjson")
+	NoError(t, err)
+	Equal(t, "no_strokes", model.Name)
+
+	sequencer.EffortModel = model
+	analysis = sequencer.Analyze(false)
+	Equal(t, 0.0, analysis.Value("effort_stroke"))
+	Equal(t, 0.833, round(analysis.Value("effort")))
+}
+
+func TestParseEffortModel(t *testing.T) {
+	model, err := ParseEffortModel([]byte(`{"stroke_weight": 1}`), "partial")
+	NoError(t, err)
+	Equal(t, "partial", model.Name)
+	Equal(t, 1.0, model.StrokeWeight)
+	Equal(t, DefaultEffortModel.BaseWeight, model.BaseWeight)
+
+	// decoding doesn't touch the defaults
+	_, err = ParseEffortModel([]byte(`{"k": [2, 2, 2], "finger_penalties": [1, 1, 1, 1, 1, 1, 1, 1, 1, 1]}`), "ones")
+	NoError(t, err)
+	ArrayEqual(t, []float64{1, 0.367, 0.235}, DefaultEffortModel.K)
+	Equal(t, 0.0, DefaultEffortModel.FingerPenalties[2])
+
+	_, err = ParseEffortModel([]byte(`{"k": [1, 0.5]}`), "short")
+	ErrorEqual(t, errors.New("effort model short: k needs 3 weights, got 2"), err)
+
+	_, err = ParseEffortModel([]byte(`{"finger_penalties": [1, 0, 0, 0, 1]}`), "hand")
+	ErrorEqual(t, errors.New("effort model hand: finger_penalties needs 10 fingers, got 5"), err)
+
+	_, err = ParseEffortModel([]byte(`{"hand_penalties": [1]}`), "left")
+	ErrorEqual(t, errors.New("effort model left: hand_penalties needs 2 hands, got 1"), err)
+}
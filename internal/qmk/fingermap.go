@@ -10,6 +10,13 @@ import (
 
 type Fingermap struct {
 	Keys []int `json:"mappings"`
+	// Movement is what each finger pays for moving, in fingermap order from
+	// the left pinky to the right thumb. Without it every finger pays the
+	// distance it moves.
+	Movement []MovementCost `json:"movement,omitempty"`
+	// Home is the key each finger rests on, by its index in Keys, in
+	// fingermap order. Fingers without one are -1.
+	Home []int `json:"home,omitempty"`
 }
 
 func BlankFingerMap(keys int) Fingermap {
@@ -18,6 +25,59 @@ func BlankFingerMap(keys int) Fingermap {
 	}
 }
 
+func (f Fingermap) Validate() error {
+	if len(f.Movement) != 0 && len(f.Movement) != 10 {
+		return fmt.Errorf("movement needs 10 fingers, got %d", len(f.Movement))
+	}
+
+	for i, cost := range f.Movement {
+		if cost.Inward < 0 || cost.Outward < 0 || cost.Up < 0 || cost.Down < 0 {
+			return fmt.Errorf("movement of finger %d can't be negative", i+1)
+		}
+	}
+
+	if len(f.Home) != 0 && len(f.Home) != 10 {
+		return fmt.Errorf("home needs 10 fingers, got %d", len(f.Home))
+	}
+
+	for i, key := range f.Home {
+		if key == -1 {
+			continue
+		}
+
+		if key < 0 || key >= len(f.Keys) {
+			return fmt.Errorf("home key %d of finger %d isn't in the fingermap", key, i+1)
+		}
+
+		if f.Keys[key] != i+1 {
+			return fmt.Errorf("home key %d of finger %d is pressed by finger %d", key, i+1, f.Keys[key])
+		}
+	}
+
+	return nil
+}
+
+// HomeKeys returns the home keys for a Sequencer.
+func (f Fingermap) HomeKeys() [10]int {
+	home := [10]int{-1, -1, -1, -1, -1, -1, -1, -1, -1, -1}
+	copy(home[:], f.Home)
+
+	return home
+}
+
+// MovementWeights returns the movement costs for a Sequencer.
+func (f Fingermap) MovementWeights() [10]MovementCost {
+	weights := [10]MovementCost{}
+	for i := range weights {
+		weights[i] = DefaultMovementCost
+		if i < len(f.Movement) {
+			weights[i] = f.Movement[i]
+		}
+	}
+
+	return weights
+}
+
 func (q *QMKHelper) SaveFingermap(layout, name string, fingermap Fingermap) error {
 	filePath := path.Join(q.FingermapDir, layout, name)
 
@@ -53,9 +113,12 @@ func (q *QMKHelper) LoadFingermapFromJSON(filePath string) (Fingermap, error) {
 		return fingermap, err
 	}
 
-	err = json.Unmarshal(bytes, &fingermap)
+	err = DecodeConfig(bytes, &fingermap)
+	if err == nil {
+		err = fingermap.Validate()
+	}
 	if err != nil {
-		return fingermap, err
+		return fingermap, fmt.Errorf("%s: %w", filePath, err)
 	}
 
 	return fingermap, nil
@@ -0,0 +1,253 @@
+package qmk
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// keyboardInfoFiles are the files a qmk_firmware keyboard directory can
+// describe itself with, at any level of its path.
+var keyboardInfoFiles = []string{"info.json", "keyboard.json"}
+
+// defaultKeymapFiles are tried in order in a keyboard's keymaps/default.
+var defaultKeymapFiles = []string{"keymap.json", "keymap.c"}
+
+// firmwareKeyboard is a keyboard found in a qmk_firmware checkout.
+type firmwareKeyboard struct {
+	Name string
+	// InfoFiles are merged in order, from the top of the keyboards tree
+	// down, the same way QMK builds a keyboard's info.
+	InfoFiles     []string
+	DefaultKeymap string
+}
+
+// IndexQMKFirmware indexes the keyboards, their layouts and default keymaps,
+// and the community layouts of a qmk_firmware checkout. Keymaps naming a
+// keyboard from the checkout then find their physical layout in it.
+func (q *QMKHelper) IndexQMKFirmware(dir string) error {
+	keyboardsDir := path.Join(dir, "keyboards") + "/"
+	names, err := findKeyboardsRecursive(keyboardsDir, keyboardsDir)
+	if err != nil {
+		return err
+	}
+
+	q.QMKFirmwareDir = dir
+	q.firmwareKeyboards = map[string]firmwareKeyboard{}
+	q.firmwareKeymaps = map[string]string{}
+
+	for _, name := range names {
+		keyboard := firmwareKeyboard{Name: name}
+
+		segments := strings.Split(name, "/")
+		for i := range segments {
+			for _, file := range keyboardInfoFiles {
+				infoPath := path.Join(keyboardsDir, path.Join(segments[:i+1]...), file)
+				if _, err := os.Stat(infoPath); err == nil {
+					keyboard.InfoFiles = append(keyboard.InfoFiles, infoPath)
+				}
+			}
+		}
+
+		// keymaps are often shared by every revision, so look upwards from the leaf
+		for i := len(segments); i > 0 && keyboard.DefaultKeymap == ""; i-- {
+			for _, file := range defaultKeymapFiles {
+				keymapPath := path.Join(keyboardsDir, path.Join(segments[:i]...), "keymaps", "default", file)
+				if _, err := os.Stat(keymapPath); err == nil {
+					keyboard.DefaultKeymap = keymapPath
+					break
+				}
+			}
+		}
+
+		q.firmwareKeyboards[name] = keyboard
+		if keyboard.DefaultKeymap != "" {
+			q.firmwareKeymaps[keyboard.DefaultKeymap] = name
+		}
+	}
+
+	return q.indexCommunityLayouts(path.Join(dir, "layouts", "default"))
+}
+
+// indexCommunityLayouts registers the layouts/default community layouts, which
+// come as info.json or as KLE raw data in layout.json.
+func (q *QMKHelper) indexCommunityLayouts(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	q.LayoutLock.Lock()
+	defer q.LayoutLock.Unlock()
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		for _, file := range []string{"info.json", "layout.json"} {
+			layoutPath := path.Join(dir, entry.Name(), file)
+			if _, err := os.Stat(layoutPath); err != nil {
+				continue
+			}
+
+			layoutData := LayoutData{}
+			err := LoadLayoutFromJSON(layoutPath, &layoutData)
+			if err != nil {
+				fmt.Printf("WARN: could not index layout file %s: %s\n", layoutPath, err.Error())
+				continue
+			}
+
+			q.registerLayouts(layoutPath, layoutData)
+			break
+		}
+	}
+
+	return nil
+}
+
+// findFirmwareKeyboard looks a keyboard up by name. A name like crkbd that
+// only has revisions below it picks the first revision.
+func (q *QMKHelper) findFirmwareKeyboard(name string) (firmwareKeyboard, bool) {
+	if name == "" {
+		return firmwareKeyboard{}, false
+	}
+
+	if keyboard, ok := q.firmwareKeyboards[name]; ok {
+		return keyboard, true
+	}
+
+	names := []string{}
+	for keyboardName := range q.firmwareKeyboards {
+		if strings.HasPrefix(keyboardName, name+"/") {
+			names = append(names, keyboardName)
+		}
+	}
+
+	if len(names) == 0 {
+		return firmwareKeyboard{}, false
+	}
+
+	sort.Strings(names)
+	return q.firmwareKeyboards[names[0]], true
+}
+
+// GetKeyboardLayoutData returns a layout variant or alias of a keyboard from
+// the indexed qmk_firmware checkout. A keyboard with a single variant serves
+// it for the plain LAYOUT macro too.
+func (q *QMKHelper) GetKeyboardLayoutData(keyboardName, layout string) (Layout, error) {
+	keyboard, ok := q.findFirmwareKeyboard(keyboardName)
+	if !ok {
+		return Layout{}, fmt.Errorf("keyboard %s not found in qmk_firmware", keyboardName)
+	}
+
+	q.LayoutLock.Lock()
+	defer q.LayoutLock.Unlock()
+
+	cacheKey := keyboard.Name + ":" + layout
+	if data, ok := q.LayoutCache.Get(cacheKey); ok {
+		cachedLayout, ok := data.(Layout)
+		if !ok {
+			return Layout{}, fmt.Errorf("layoutCache entry for %s is not expected type of Layout: %+v", cacheKey, data)
+		}
+		return cachedLayout, nil
+	}
+
+	merged, err := mergeKeyboardInfo(keyboard)
+	if err != nil {
+		return Layout{}, err
+	}
+
+	resolved, ok := merged.Resolve(layout)
+	if !ok && layout == "LAYOUT" && len(merged.Layout) == 1 {
+		for _, variant := range merged.Layout {
+			resolved, ok = variant["layout"], true
+		}
+	}
+
+	if !ok {
+		return Layout{}, fmt.Errorf("layout %s not found for keyboard %s, it has %v", layout, keyboard.Name, merged.Names())
+	}
+
+	q.LayoutCache.Set(cacheKey, resolved)
+
+	return resolved, nil
+}
+
+// GetLayoutForKeymap finds the physical layout of a keymap, from its keyboard
+// in the qmk_firmware checkout when there is one, otherwise by layout name.
+func (q *QMKHelper) GetLayoutForKeymap(keymap *KeymapData) (Layout, error) {
+	if _, ok := q.findFirmwareKeyboard(keymap.Keyboard); ok {
+		layout, err := q.GetKeyboardLayoutData(keymap.Keyboard, keymap.Layout)
+		if err == nil {
+			return layout, nil
+		}
+		fmt.Printf("WARN: %s, falling back to layout files\n", err.Error())
+	}
+
+	return q.GetLayoutData(keymap.Layout)
+}
+
+// mergeKeyboardInfo merges the info.json and keyboard.json files of a
+// keyboard, the ones further down its directories taking precedence.
+func mergeKeyboardInfo(keyboard firmwareKeyboard) (LayoutData, error) {
+	merged := LayoutData{
+		Layout:        map[string]map[string]Layout{},
+		LayoutAliases: map[string]string{},
+	}
+	for _, infoPath := range keyboard.InfoFiles {
+		layoutData := LayoutData{}
+		err := LoadLayoutFromJSON(infoPath, &layoutData)
+		if err != nil {
+			return merged, err
+		}
+
+		for name, variant := range layoutData.Layout {
+			merged.Layout[name] = variant
+		}
+		for alias, target := range layoutData.LayoutAliases {
+			merged.LayoutAliases[alias] = target
+		}
+		if layoutData.KeyPitch != nil {
+			merged.KeyPitch = layoutData.KeyPitch
+		}
+	}
+
+	return merged, nil
+}
+
+// GetPitchForKeymap returns the key spacing of the keymap's keyboard, found
+// the same way as its layout.
+func (q *QMKHelper) GetPitchForKeymap(keymap *KeymapData) KeyPitch {
+	if keyboard, ok := q.findFirmwareKeyboard(keymap.Keyboard); ok {
+		merged, err := mergeKeyboardInfo(keyboard)
+		if err == nil {
+			return merged.Pitch()
+		}
+		fmt.Printf("WARN: %s, falling back to layout files\n", err.Error())
+	}
+
+	return q.GetLayoutPitch(keymap.Layout)
+}
+
+// GetFirmwareKeymaps lists the default keymap of every indexed keyboard. They
+// aren't loaded until picked, so their layout is not known yet.
+func (q *QMKHelper) GetFirmwareKeymaps() []KeymapOption {
+	keymapOptions := []KeymapOption{}
+	for keymapPath, keyboard := range q.firmwareKeymaps {
+		keymapOptions = append(keymapOptions, KeymapOption{
+			Name: keyboard + ":default",
+			ID:   keymapPath,
+		})
+	}
+
+	sort.Slice(keymapOptions, func(i, j int) bool {
+		return keymapOptions[i].Name < keymapOptions[j].Name
+	})
+
+	return keymapOptions
+}
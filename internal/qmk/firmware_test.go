@@ -0,0 +1,126 @@
+package qmk
+
+import (
+	"errors"
+	"testing"
+)
+
+func newFirmwareHelper(t *testing.T) *QMKHelper {
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	NoError(t, q.IndexQMKFirmware("./test_content/qmk_firmware"))
+
+	return q
+}
+
+func TestIndexQMKFirmware(t *testing.T) {
+	q := newFirmwareHelper(t)
+
+	keyboard, ok := q.findFirmwareKeyboard("testboard")
+	Equal(t, true, ok)
+	Equal(t, "testboard/rev1", keyboard.Name)
+	ArrayEqual(t, []string{
+		"test_content/qmk_firmware/keyboards/testboard/info.json",
+		"test_content/qmk_firmware/keyboards/testboard/rev1/keyboard.json",
+	}, keyboard.InfoFiles)
+	// the keymap is shared from the parent directory
+	Equal(t, "test_content/qmk_firmware/keyboards/testboard/keymaps/default/keymap.c", keyboard.DefaultKeymap)
+
+	_, ok = q.findFirmwareKeyboard("missing")
+	Equal(t, false, ok)
+
+	// helper directories without their own info.json aren't keyboards, and
+	// don't hide the keyboard they sit in
+	_, ok = q.firmwareKeyboards["testboard/lib"]
+	Equal(t, false, ok)
+	_, ok = q.firmwareKeyboards["flatboard/common"]
+	Equal(t, false, ok)
+
+	keyboard, ok = q.findFirmwareKeyboard("flatboard")
+	Equal(t, true, ok)
+	Equal(t, "flatboard", keyboard.Name)
+
+	keymaps := q.GetFirmwareKeymaps()
+	Equal(t, 2, len(keymaps))
+	Equal(t, "flatboard:default", keymaps[0].Name)
+	Equal(t, "testboard/rev1:default", keymaps[1].Name)
+
+	// community layouts are indexed alongside the layout directory
+	layouts, err := q.GetAllLayouts()
+	NoError(t, err)
+	ArrayContains(t, "LAYOUT_tiny_kle", layouts)
+
+	layout, err := q.GetLayoutData("LAYOUT_tiny_kle")
+	NoError(t, err)
+	GreaterThan(t, 0, len(layout))
+}
+
+func TestGetLayoutForKeymap(t *testing.T) {
+	q := newFirmwareHelper(t)
+
+	// keymap.c files get their keyboard from where they were found
+	keymap, err := q.GetKeymapData("test_content/qmk_firmware/keyboards/testboard/keymaps/default/keymap.c")
+	NoError(t, err)
+	Equal(t, "testboard/rev1", keymap.Keyboard)
+	Equal(t, "LAYOUT", keymap.Layout)
+
+	layout, err := q.GetLayoutForKeymap(&keymap)
+	NoError(t, err)
+	Equal(t, 34, len(layout))
+
+	// the revision's spacing overrides the keyboard's
+	Equal(t, KeyPitch{X: 18, Y: 17}, q.GetPitchForKeymap(&keymap))
+
+	// a single variant serves the plain LAYOUT macro
+	keymap, err = q.GetKeymapData("test_content/qmk_firmware/keyboards/flatboard/keymaps/default/keymap.json")
+	NoError(t, err)
+	Equal(t, "flatboard", keymap.Keyboard)
+
+	layout, err = q.GetLayoutForKeymap(&keymap)
+	NoError(t, err)
+	Equal(t, 3, len(layout))
+	Equal(t, DefaultKeyPitch, q.GetPitchForKeymap(&keymap))
+
+	// keymaps without a known keyboard still use the layout files
+	keymap = KeymapData{Keyboard: "missing", Layout: "LAYOUT_split_3x5_2"}
+	layout, err = q.GetLayoutForKeymap(&keymap)
+	NoError(t, err)
+	Equal(t, 34, len(layout))
+
+	_, err = q.GetKeyboardLayoutData("testboard", "LAYOUT_ortho_1x3")
+	ErrorEqual(t, errors.New("layout LAYOUT_ortho_1x3 not found for keyboard testboard/rev1, it has [LAYOUT LAYOUT_split_3x5_2]"), err)
+
+	_, err = q.GetKeyboardLayoutData("missing", "LAYOUT")
+	ErrorEqual(t, errors.New("keyboard missing not found in qmk_firmware"), err)
+}
+
+func TestNewKeymapSequencerPitch(t *testing.T) {
+	q := newFirmwareHelper(t)
+
+	layout, err := q.GetLayoutData("LAYOUT_split_3x5_2")
+	NoError(t, err)
+
+	fingermap, err := q.LoadFingermapFromJSON("./test_content/fingermaps/LAYOUT_split_3x5_2/ferris_sweep_test.json")
+	NoError(t, err)
+
+	// both keymaps are compared on the same layout, but the firmware one is
+	// for a board spaced at 18x17mm
+	choc, err := q.GetKeymapData("test_content/qmk_firmware/keyboards/testboard/keymaps/default/keymap.c")
+	NoError(t, err)
+	mx, err := q.GetKeymapData("./test_content/keymaps/LAYOUT_split_3x5_2/ferris_sweep_test.json")
+	NoError(t, err)
+
+	travel := func(keymap *KeymapData, pitch KeyPitch) float64 {
+		sequencer, err := q.NewKeymapSequencer(keymap, fingermap, layout)
+		NoError(t, err)
+		Equal(t, pitch, sequencer.Pitch)
+
+		NoError(t, sequencer.Build("tdt"))
+		table, _ := sequencer.Analyze(false).Table("travel", "By Finger")
+		return table.Fingers[3]
+	}
+
+	Equal(t, 34.0, travel(&choc, KeyPitch{X: 18, Y: 17}))
+	Equal(t, 38.0, travel(&mx, DefaultKeyPitch))
+}
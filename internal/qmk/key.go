@@ -1,206 +1,332 @@
 package qmk
 
 import (
-	"errors"
 	"fmt"
-	"slices"
-	"strconv"
 	"strings"
 )
 
+// modMasks maps the MOD_* constants used in OSM() and MT() to their modifiers.
+var modMasks = map[string]ModMask{
+	"LCTL": ModLCtl,
+	"LSFT": ModLSft,
+	"LALT": ModLAlt,
+	"LGUI": ModLGui,
+	"RCTL": ModRCtl,
+	"RSFT": ModRSft,
+	"RALT": ModRAlt,
+	"RGUI": ModRGui,
+	"MEH":  ModMeh,
+	"HYPR": ModHypr,
+}
+
+// modFunctions are the wrappers that send a keycode with modifiers held,
+// e.g. LCTL(KC_Z) or C(KC_Z).
+var modFunctions = map[string]ModMask{
+	"LCTL": ModLCtl, "C": ModLCtl,
+	"LSFT": ModLSft, "S": ModLSft,
+	"LALT": ModLAlt, "A": ModLAlt, "LOPT": ModLAlt,
+	"LGUI": ModLGui, "G": ModLGui, "LCMD": ModLGui, "LWIN": ModLGui,
+	"RCTL": ModRCtl,
+	"RSFT": ModRSft,
+	"RALT": ModRAlt, "ROPT": ModRAlt, "ALGR": ModRAlt,
+	"RGUI": ModRGui, "RCMD": ModRGui, "RWIN": ModRGui,
+	"LCS": ModLCtl | ModLSft,
+	"LCA": ModLCtl | ModLAlt,
+	"LSA": ModLSft | ModLAlt,
+	"LAG": ModLAlt | ModLGui,
+	"LSG": ModLSft | ModLGui, "SGUI": ModLSft | ModLGui, "SCMD": ModLSft | ModLGui, "SWIN": ModLSft | ModLGui,
+	"LCAG": ModLCtl | ModLAlt | ModLGui,
+	"RCS":  ModRCtl | ModRSft,
+	"RSA":  ModRSft | ModRAlt, "SAGR": ModRSft | ModRAlt,
+	"RAG":  ModRAlt | ModRGui,
+	"RSG":  ModRSft | ModRGui,
+	"RCAG": ModRCtl | ModRAlt | ModRGui,
+	"MEH":  ModMeh,
+	"HYPR": ModHypr,
+}
+
+// modTapFunctions are the mod-tap keys, which send their keycode on tap and
+// hold their modifiers otherwise.
+var modTapFunctions = map[string]ModMask{
+	"LCTL_T": ModLCtl, "CTL_T": ModLCtl,
+	"LSFT_T": ModLSft, "SFT_T": ModLSft,
+	"LALT_T": ModLAlt, "ALT_T": ModLAlt, "LOPT_T": ModLAlt, "OPT_T": ModLAlt,
+	"LGUI_T": ModLGui, "GUI_T": ModLGui, "LCMD_T": ModLGui, "CMD_T": ModLGui, "LWIN_T": ModLGui, "WIN_T": ModLGui,
+	"RCTL_T": ModRCtl,
+	"RSFT_T": ModRSft,
+	"RALT_T": ModRAlt, "ROPT_T": ModRAlt, "ALGR_T": ModRAlt,
+	"RGUI_T": ModRGui, "RCMD_T": ModRGui, "RWIN_T": ModRGui,
+	"LCS_T": ModLCtl | ModLSft, "C_S_T": ModLCtl | ModLSft,
+	"LCA_T": ModLCtl | ModLAlt,
+	"LSA_T": ModLSft | ModLAlt,
+	"LAG_T": ModLAlt | ModLGui,
+	"LSG_T": ModLSft | ModLGui, "SGUI_T": ModLSft | ModLGui, "SCMD_T": ModLSft | ModLGui, "SWIN_T": ModLSft | ModLGui,
+	"LCAG_T": ModLCtl | ModLAlt | ModLGui,
+	"RCS_T":  ModRCtl | ModRSft,
+	"RSA_T":  ModRSft | ModRAlt,
+	"RAG_T":  ModRAlt | ModRGui,
+	"RSG_T":  ModRSft | ModRGui,
+	"RCAG_T": ModRCtl | ModRAlt | ModRGui,
+	"MEH_T":  ModMeh,
+	"HYPR_T": ModHypr, "ALL_T": ModHypr,
+}
+
+type KeycodeKind int
+
+const (
+	BasicKeycode KeycodeKind = iota
+	OneShotModKeycode
+)
+
+// ModMask is a set of modifiers, one bit per modifier key.
+type ModMask uint8
+
+const (
+	ModLCtl ModMask = 1 << iota
+	ModLSft
+	ModLAlt
+	ModLGui
+	ModRCtl
+	ModRSft
+	ModRAlt
+	ModRGui
+)
+
+const (
+	ModMeh  = ModLCtl | ModLSft | ModLAlt
+	ModHypr = ModMeh | ModLGui
+)
+
+var modOrder = []ModMask{ModLCtl, ModLSft, ModLAlt, ModLGui, ModRCtl, ModRSft, ModRAlt, ModRGui}
+
+var modKeyNames = map[ModMask]string{
+	ModLCtl: "lctl",
+	ModLSft: "lsft",
+	ModLAlt: "lalt",
+	ModLGui: "lgui",
+	ModRCtl: "rctl",
+	ModRSft: "rsft",
+	ModRAlt: "ralt",
+	ModRGui: "rgui",
+}
+
+// Names returns the key name of every modifier in the mask, ordered
+// left-hand first and ctrl, shift, alt, gui within each hand.
+func (m ModMask) Names() []string {
+	names := []string{}
+	for _, mod := range modOrder {
+		if m&mod != 0 {
+			names = append(names, modKeyNames[mod])
+		}
+	}
+
+	return names
+}
+
+func (m ModMask) String() string {
+	return strings.Join(m.Names(), "+")
+}
+
+// Constant returns the mask as MOD_* constants, e.g. MOD_LCTL|MOD_LSFT.
+func (m ModMask) Constant() string {
+	constants := []string{}
+	for _, name := range m.Names() {
+		constants = append(constants, "MOD_"+strings.ToUpper(name))
+	}
+
+	return strings.Join(constants, "|")
+}
+
+// ShiftOnly reports whether the mask holds nothing but shift.
+func (m ModMask) ShiftOnly() bool {
+	return m != 0 && m&^(ModLSft|ModRSft) == 0
+}
+
+// Shortcut returns the keyfinder name for val sent with mods held.
+func Shortcut(mods ModMask, val string) string {
+	return mods.String() + "+" + val
+}
+
 type KC struct {
 	Default string
 	Shift   string
-	Hold    string
+	// Hold is the layer action of a layer key, e.g. "LT 1".
+	Hold string
+	// HoldMods are the modifiers registered while the key is held, as with
+	// KC_LSFT or the mod-tap keys.
+	HoldMods ModMask
+	// Mods are the modifiers sent along with the key when tapped, as with
+	// LSFT(KC_1) or C(KC_Z).
+	Mods ModMask
+	Kind KeycodeKind
 }
 
-var keyTypes = []string{"KC", "QK", "RGB"}
-
 type Parser struct {
 	Basic map[string]KC
 }
 
+// KeyQueue holds a single keycode string waiting to be parsed.
 type KeyQueue struct {
-	queue []string
+	keycode  string
+	keycodes *KeycodeTable
 }
 
-func (k *KeyQueue) Push(val string) {
-	k.queue = append(k.queue, val)
-}
+// Parse parses the keycode and flattens its AST into a KC.
+func (k *KeyQueue) Parse() (KC, error) {
+	node, err := ParseKeycode(k.keycode)
+	if err != nil {
+		return KC{}, err
+	}
 
-func (k *KeyQueue) Pop() string {
-	if len(k.queue) == 0 {
-		return ""
+	table := k.keycodes
+	if table == nil {
+		table = defaultKeycodeTable()
 	}
 
-	next := k.queue[0]
-	k.queue = k.queue[1:]
+	key := keycodeFromNode(node, table)
+
+	// shift wrapped around a key just selects its shifted value, S(KC_1) is "!"
+	if key.Mods.ShiftOnly() && key.Shift != "" {
+		key.Default = key.Shift
+		key.Shift = ""
+		key.Mods = 0
+	}
 
-	return next
+	return key, nil
 }
 
-func (k *KeyQueue) PeekTail() string {
-	if len(k.queue) == 0 {
-		return ""
+// specKeycode returns the keycode labelled from the QMK keycode spec.
+func specKeycode(name string, table *KeycodeTable) (KC, bool) {
+	keycode, ok := table.Lookup(name)
+	if !ok {
+		return KC{}, false
+	}
+
+	label := keycode.Label
+	if label == "" {
+		label = name
 	}
 
-	return k.queue[len(k.queue)-1]
+	return KC{Default: label}, true
 }
 
-func (k *KeyQueue) Parse() (KC, error) {
-	next := ""
-	key := KC{}
-
-	parenOpen := 0
-
-	for k.PeekTail() != "" {
-		next = k.Pop()
-
-		if next == "KC" {
-			val := k.Pop()
-			runeVal := []rune(val)
-
-			if len(runeVal) == 1 && 'A' <= runeVal[0] && 'Z' >= runeVal[0] {
-				key.Default += strings.ToLower(val)
-				key.Shift += val
-			} else {
-				kc, ok := keycodes[val]
-				if !ok {
-					fmt.Printf("WARN: keycap %s does not exist in keycode map\n", val)
-					key.Default += val
-				} else {
-
-					key.Default += kc.Default
-					key.Shift += kc.Shift
-					key.Hold += kc.Hold
-				}
-			}
-		} else if slices.Contains([]string{"LSFT", "LCTL", "LALT", "LGUI", "RSFT", "RCTL", "RALT", "RGUI"}, next) {
-			val := k.Pop()
-			if val == "T" {
-				key.Hold = strings.ToLower(next)
-			} else if val == "_SP" {
-				key.Default += "<" + strings.ToLower(next)
-				key.Shift += "<" + strings.ToLower(next)
-				parenOpen += 1
-			}
-		} else if next == "LT" {
-			val := k.Pop()
-			if val != "_SP" {
-				return KC{}, errors.New("didn't find _SP after LT")
-			}
-			parenOpen += 1
+// basicKeycode looks a KC_ keycode up in the QMK keycode spec, which decides
+// whether it exists. keyOutputs gives what it types when that isn't its label.
+func basicKeycode(name string, table *KeycodeTable) (KC, bool) {
+	if alias, ok := legacyKeycodes[name]; ok {
+		name = alias
+	}
 
-			val = k.Pop()
-			layerInt, err := strconv.Atoi(val)
-			if err != nil {
-				return KC{}, err
-			}
+	if key, ok := shiftedKeycodes[name]; ok {
+		kc, ok := basicKeycode(key, table)
+		return KC{Default: kc.Shift}, ok
+	}
 
-			key.Hold = fmt.Sprintf("LT %d", layerInt)
-		} else if next == "MO" {
-			val := k.Pop()
-			if val != "_SP" {
-				return KC{}, errors.New("didn't find _SP after LT")
-			}
-			parenOpen += 1
+	keycode, ok := table.Lookup(name)
+	if !ok {
+		return KC{}, false
+	}
 
-			val = k.Pop()
-			layerInt, err := strconv.Atoi(val)
-			if err != nil {
-				return KC{}, err
-			}
+	if kc, ok := keyOutputs[keycode.Key]; ok {
+		return kc, true
+	}
 
-			key.Hold = fmt.Sprintf("MO %d", layerInt)
-			key.Default = fmt.Sprintf("MO %d", layerInt)
-		} else if next == "TO" {
-			val := k.Pop()
-			if val != "_SP" {
-				return KC{}, errors.New("didn't find _SP after LT")
-			}
-			parenOpen += 1
+	runeVal := []rune(keycode.Label)
+	if len(runeVal) == 1 && 'A' <= runeVal[0] && 'Z' >= runeVal[0] {
+		return KC{Default: strings.ToLower(keycode.Label), Shift: keycode.Label}, true
+	}
 
-			val = k.Pop()
-			layerInt, err := strconv.Atoi(val)
-			if err != nil {
-				return KC{}, err
-			}
+	return specKeycode(keycode.Key, table)
+}
 
-			key.Default = fmt.Sprintf("TG %d", layerInt)
-		} else if next == "TG" {
-			val := k.Pop()
-			if val != "_SP" {
-				return KC{}, errors.New("didn't find _SP after LT")
-			}
-			parenOpen += 1
+func keycodeFromNode(node KeycodeNode, table *KeycodeTable) KC {
+	switch n := node.(type) {
+	case BasicKeycodeNode:
+		kc, ok := basicKeycode("KC_"+n.Name, table)
+		if !ok {
+			fmt.Printf("WARN: keycode KC_%s is not in the QMK keycode spec\n", n.Name)
+			return KC{Default: n.Name}
+		}
 
-			val = k.Pop()
-			layerInt, err := strconv.Atoi(val)
-			if err != nil {
-				return KC{}, err
-			}
+		return kc
+	case ModifierNode:
+		key := keycodeFromNode(n.Key, table)
+		key.Mods |= n.Mods
+		return key
+	case ModTapNode:
+		key := keycodeFromNode(n.Key, table)
+		key.HoldMods |= n.Mods
+		return key
+	case OneShotModNode:
+		return KC{Default: "OSM " + n.Mods.String(), Kind: OneShotModKeycode}
+	case LayerTapNode:
+		key := keycodeFromNode(n.Key, table)
+		key.Hold = fmt.Sprintf("LT %d", n.Layer)
+		return key
+	case LayerFunctionNode:
+		action := fmt.Sprintf("%s %d", n.Function, n.Layer)
+		return KC{Default: action, Hold: action}
+	case QuantumNode:
+		if kc, ok := specKeycode(n.Name, table); ok {
+			return kc
+		}
 
-			key.Hold = fmt.Sprintf("TG %d", layerInt)
-		} else if next == "DF" {
-			val := k.Pop()
-			if val != "_SP" {
-				return KC{}, errors.New("didn't find _SP after LT")
+		name := strings.TrimPrefix(n.Name, "QK_")
+		return KC{Default: name, Shift: name}
+	case UnknownNode:
+		if len(n.Args) == 0 {
+			if kc, ok := specKeycode(n.Name, table); ok {
+				return kc
 			}
-			parenOpen += 1
+		}
 
-			val = k.Pop()
-			layerInt, err := strconv.Atoi(val)
-			if err != nil {
-				return KC{}, err
-			}
+		fmt.Printf("WARN: key-type %s not implemented\n", n.Name)
+		if len(n.Args) == 0 {
+			return KC{Default: n.Name}
+		}
 
-			key.Hold = fmt.Sprintf("DF %d", layerInt)
-		} else if next == "OSL" {
-			val := k.Pop()
-			if val != "_SP" {
-				return KC{}, errors.New("didn't find _SP after LT")
-			}
-			parenOpen += 1
+		args := []string{}
+		for _, arg := range n.Args {
+			args = append(args, keycodeFromNode(arg, table).Default)
+		}
 
-			val = k.Pop()
-			layerInt, err := strconv.Atoi(val)
-			if err != nil {
-				return KC{}, err
-			}
+		return KC{Default: fmt.Sprintf("%s(%s)", n.Name, strings.Join(args, ", "))}
+	}
 
-			key.Default = fmt.Sprintf("OS %d", layerInt)
-		} else if next == "_SP" {
-			parenOpen += 1
-		} else if next == "QK" {
-			val := k.Pop()
-			key.Default += val
-			key.Shift += val
-		} else if next == "_EP" {
-			if strings.Contains(key.Default, "<") && key.Default != "<" {
-				key.Default += ">"
-			}
-			if strings.Contains(key.Shift, "<") && key.Shift != "<" {
-				key.Shift += ">"
-			}
-			parenOpen -= 1
-		} else {
-			fmt.Printf("WARN: key-type %s not implemented\n", next)
-			key.Default += next + " "
-		}
+	return KC{}
+}
+
+// Output returns the value the key sends when tapped, including any
+// modifiers sent along with it.
+func (kc KC) Output() string {
+	if kc.Mods != 0 {
+		return Shortcut(kc.Mods, kc.Default)
 	}
 
-	if parenOpen != 0 {
-		return KC{}, errors.New(fmt.Sprintf("encountered %d unbalanced parentheses", parenOpen))
+	return kc.Default
+}
+
+// HoldLabel returns what the key does when held, if anything.
+func (kc KC) HoldLabel() string {
+	if kc.HoldMods != 0 {
+		return kc.HoldMods.String()
 	}
 
-	return key, nil
+	return kc.Hold
 }
 
 func ParseLayer(input []string) ([]KC, error) {
+	return ParseLayerWithKeycodes(input, nil)
+}
+
+// ParseLayerWithKeycodes parses a layer using the given keycode table, nil
+// meaning the latest one.
+func ParseLayerWithKeycodes(input []string, table *KeycodeTable) ([]KC, error) {
 	keys := []KC{}
 
 	for _, key := range input {
 		queue := CreateQueue(key)
+		queue.keycodes = table
 		kc, err := queue.Parse()
 
 		if err != nil {
@@ -213,55 +339,6 @@ func ParseLayer(input []string) ([]KC, error) {
 	return keys, nil
 }
 
-func newKeyQueue() KeyQueue {
-	return KeyQueue{queue: []string{}}
-}
-
 func CreateQueue(keycode string) KeyQueue {
-	k := newKeyQueue()
-	buf := ""
-
-	for _, c := range keycode {
-		if c == ',' {
-			k.Push(buf)
-			buf = ""
-			continue
-		}
-
-		if c == '(' {
-			k.Push(buf)
-			k.Push("_SP")
-			buf = ""
-			continue
-		}
-
-		if c == ')' {
-			if buf != "" {
-				k.Push(buf)
-			}
-			k.Push("_EP")
-			buf = ""
-			continue
-		}
-
-		if c == '_' {
-			if !slices.Contains(keyTypes, k.PeekTail()) {
-				k.Push(buf)
-				buf = ""
-				continue
-			}
-		}
-
-		if c == ' ' {
-			continue
-		}
-
-		buf += string(c)
-	}
-
-	if buf != "" {
-		k.Push(buf)
-	}
-
-	return k
+	return KeyQueue{keycode: keycode}
 }
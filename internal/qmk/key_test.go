@@ -2,50 +2,64 @@ package qmk
 
 import "testing"
 
-func TestBuildBasic(t *testing.T) {
+func lexTexts(t *testing.T, keycode string) []string {
+	tokens, err := Lex(keycode)
+	NoError(t, err)
+
+	texts := []string{}
+	for _, token := range tokens {
+		if token.Kind != TokenEOF {
+			texts = append(texts, token.Text)
+		}
+	}
+
+	return texts
+}
+
+func TestLexBasic(t *testing.T) {
 	keycode := "KC_A"
-	expected := []string{"KC", "A"}
-	ArrayEqual(t, expected, CreateQueue(keycode).queue)
+	expected := []string{"KC_A"}
+	ArrayEqual(t, expected, lexTexts(t, keycode))
 
 	keycode = "KC_SEMICOLON"
-	expected = []string{"KC", "SEMICOLON"}
-	ArrayEqual(t, expected, CreateQueue(keycode).queue)
+	expected = []string{"KC_SEMICOLON"}
+	ArrayEqual(t, expected, lexTexts(t, keycode))
 
 	keycode = "KC_RIGHT_SHIFT"
-	expected = []string{"KC", "RIGHT_SHIFT"}
-	ArrayEqual(t, expected, CreateQueue(keycode).queue)
+	expected = []string{"KC_RIGHT_SHIFT"}
+	ArrayEqual(t, expected, lexTexts(t, keycode))
 }
 
-func TestBuildQuantum(t *testing.T) {
+func TestLexQuantum(t *testing.T) {
 	keycode := "QK_MAKE"
-	expected := []string{"QK", "MAKE"}
-	ArrayEqual(t, expected, CreateQueue(keycode).queue)
+	expected := []string{"QK_MAKE"}
+	ArrayEqual(t, expected, lexTexts(t, keycode))
 
 	keycode = "QK_DEBUG_TOGGLE"
-	expected = []string{"QK", "DEBUG_TOGGLE"}
-	ArrayEqual(t, expected, CreateQueue(keycode).queue)
+	expected = []string{"QK_DEBUG_TOGGLE"}
+	ArrayEqual(t, expected, lexTexts(t, keycode))
 
 	keycode = "QK_AUDIO_CLICKY_TOGGLE"
-	expected = []string{"QK", "AUDIO_CLICKY_TOGGLE"}
-	ArrayEqual(t, expected, CreateQueue(keycode).queue)
+	expected = []string{"QK_AUDIO_CLICKY_TOGGLE"}
+	ArrayEqual(t, expected, lexTexts(t, keycode))
 }
 
-func TestParen(t *testing.T) {
+func TestLexParen(t *testing.T) {
 	keycode := "DF(layer)"
-	expected := []string{"DF", "_SP", "layer", "_EP"}
-	ArrayEqual(t, expected, CreateQueue(keycode).queue)
+	expected := []string{"DF", "(", "layer", ")"}
+	ArrayEqual(t, expected, lexTexts(t, keycode))
 
 	keycode = "LT(layer, kc)"
-	expected = []string{"LT", "_SP", "layer", "kc", "_EP"}
-	ArrayEqual(t, expected, CreateQueue(keycode).queue)
+	expected = []string{"LT", "(", "layer", ",", "kc", ")"}
+	ArrayEqual(t, expected, lexTexts(t, keycode))
 
 	keycode = "LT(layer, KC_A)"
-	expected = []string{"LT", "_SP", "layer", "KC", "A", "_EP"}
-	ArrayEqual(t, expected, CreateQueue(keycode).queue)
+	expected = []string{"LT", "(", "layer", ",", "KC_A", ")"}
+	ArrayEqual(t, expected, lexTexts(t, keycode))
 
 	keycode = "OUTER(layer, INNER(KC_A))"
-	expected = []string{"OUTER", "_SP", "layer", "INNER", "_SP", "KC", "A", "_EP", "_EP"}
-	ArrayEqual(t, expected, CreateQueue(keycode).queue)
+	expected = []string{"OUTER", "(", "layer", ",", "INNER", "(", "KC_A", ")", ")"}
+	ArrayEqual(t, expected, lexTexts(t, keycode))
 }
 
 func TestParseKeycapBasicLetter(t *testing.T) {
@@ -71,3 +85,76 @@ func TestParseKeycapBasicOther(t *testing.T) {
 	NoError(t, err)
 	Equal(t, KC{Default: ";", Shift: ":"}, res)
 }
+
+func TestParseKeycapLayerChange(t *testing.T) {
+	keycode := "TO(3)"
+	queue := CreateQueue(keycode)
+	res, err := queue.Parse()
+	NoError(t, err)
+	Equal(t, KC{Default: "TO 3", Hold: "TO 3"}, res)
+
+	keycode = "OSL(2)"
+	queue = CreateQueue(keycode)
+	res, err = queue.Parse()
+	NoError(t, err)
+	Equal(t, KC{Default: "OSL 2", Hold: "OSL 2"}, res)
+}
+
+func TestParseKeycapOneShotMod(t *testing.T) {
+	keycode := "OSM(MOD_LSFT)"
+	queue := CreateQueue(keycode)
+	res, err := queue.Parse()
+	NoError(t, err)
+	Equal(t, KC{Default: "OSM lsft", Kind: OneShotModKeycode}, res)
+
+	keycode = "OSM(MOD_LCTL|MOD_LSFT)"
+	queue = CreateQueue(keycode)
+	res, err = queue.Parse()
+	NoError(t, err)
+	Equal(t, KC{Default: "OSM lctl+lsft", Kind: OneShotModKeycode}, res)
+}
+
+func TestParseKeycapModTap(t *testing.T) {
+	cases := map[string]KC{
+		"LSFT_T(KC_A)":                  {Default: "a", Shift: "A", HoldMods: ModLSft},
+		"MT(MOD_LCTL | MOD_LSFT, KC_A)": {Default: "a", Shift: "A", HoldMods: ModLCtl | ModLSft},
+		"MT(MOD_RALT, KC_ENT)":          {Default: "enter", HoldMods: ModRAlt},
+		"C_S_T(KC_B)":                   {Default: "b", Shift: "B", HoldMods: ModLCtl | ModLSft},
+		"MEH_T(KC_C)":                   {Default: "c", Shift: "C", HoldMods: ModMeh},
+		"HYPR_T(KC_D)":                  {Default: "d", Shift: "D", HoldMods: ModHypr},
+		"ALL_T(KC_E)":                   {Default: "e", Shift: "E", HoldMods: ModHypr},
+		"KC_LCTL":                       {HoldMods: ModLCtl},
+	}
+
+	for keycode, expected := range cases {
+		queue := CreateQueue(keycode)
+		res, err := queue.Parse()
+		NoError(t, err)
+		Equal(t, expected, res)
+	}
+}
+
+func TestParseKeycapModifierWrapper(t *testing.T) {
+	cases := map[string]KC{
+		"S(KC_1)":     {Default: "!"},
+		"LSFT(KC_A)":  {Default: "A"},
+		"C(KC_Z)":     {Default: "z", Shift: "Z", Mods: ModLCtl},
+		"A(KC_TAB)":   {Default: "tab", Mods: ModLAlt},
+		"G(KC_L)":     {Default: "l", Shift: "L", Mods: ModLGui},
+		"LCS(KC_Z)":   {Default: "z", Shift: "Z", Mods: ModLCtl | ModLSft},
+		"C(S(KC_Z))":  {Default: "z", Shift: "Z", Mods: ModLCtl | ModLSft},
+		"HYPR(KC_F1)": {Default: "F1", Mods: ModHypr},
+	}
+
+	for keycode, expected := range cases {
+		queue := CreateQueue(keycode)
+		res, err := queue.Parse()
+		NoError(t, err)
+		Equal(t, expected, res)
+	}
+
+	queue := CreateQueue("LCS(KC_Z)")
+	res, err := queue.Parse()
+	NoError(t, err)
+	Equal(t, "lctl+lsft+z", res.Output())
+}
@@ -15,13 +15,18 @@ type Keyboard struct {
 }
 
 type Key struct {
-	X      float64
-	Y      float64
-	W      float64
-	H      float64
-	Keycap KeyCap
-	Finger int
-	Index  int
+	X float64
+	Y float64
+	W float64
+	H float64
+	// R rotates the key by R degrees around (OriginX, OriginY), which is
+	// relative to the key's top left corner.
+	R       float64
+	OriginX float64
+	OriginY float64
+	Keycap  KeyCap
+	Finger  int
+	Index   int
 }
 
 type KeyCap struct {
@@ -52,29 +57,51 @@ func (q *QMKHelper) GetKeyboard(layout *Layout, keymap *KeymapData, layer int) (
 		Keys:         []Key{},
 	}
 
+	// KeySize is how big MX spaced keys are drawn, keys spaced otherwise are
+	// drawn to the same scale
+	pitch := DefaultKeyPitch
+	if keymap != nil {
+		pitch = q.GetPitchForKeymap(keymap)
+	}
+	xPitch, yPitch := pitch.Millimeters(1, 1)
+	xSize := q.KeySize * xPitch / DefaultKeyPitch.X
+	ySize := q.KeySize * yPitch / DefaultKeyPitch.Y
+
 	maxTop := 0.0
 	maxLeft := 0.0
 
 	for i, keyPosition := range *layout {
 		newKey := Key{
-			X: keyPosition.X*q.KeySize + 5.0,
-			Y: keyPosition.Y*q.KeySize + 5.0,
-			W: max(q.KeySize, keyPosition.W*q.KeySize),
-			H: max(q.KeySize, keyPosition.H*q.KeySize),
+			X: keyPosition.X*xSize + 5.0,
+			Y: keyPosition.Y*ySize + 5.0,
+			W: max(xSize, keyPosition.W*xSize),
+			H: max(ySize, keyPosition.H*ySize),
 			Keycap: KeyCap{
-				MainSize:     q.KeySize / 3,
-				ModifierSize: q.KeySize / 5,
+				MainSize:     min(xSize, ySize) / 3,
+				ModifierSize: min(xSize, ySize) / 5,
 			},
 			Index: i,
 		}
 
+		if keyPosition.R != 0 {
+			newKey.R = keyPosition.R
+			newKey.OriginX = (keyPosition.RX - keyPosition.X) * xSize
+			newKey.OriginY = (keyPosition.RY - keyPosition.Y) * ySize
+		}
+
 		keyboard.Keys = append(keyboard.Keys, newKey)
 
-		left := keyPosition.X*q.KeySize + newKey.W
+		left := keyPosition.X*xSize + newKey.W
 		maxLeft = max(left, maxLeft)
 
-		top := keyPosition.Y*q.KeySize + newKey.H
+		top := keyPosition.Y*ySize + newKey.H
 		maxTop = max(top, maxTop)
+
+		// rotated keys can reach past their unrotated box
+		for _, corner := range keyPosition.Corners() {
+			maxLeft = max(corner[0]*xSize, maxLeft)
+			maxTop = max(corner[1]*ySize, maxTop)
+		}
 	}
 
 	keyboard.Height = maxTop + 10.0
@@ -0,0 +1,398 @@
+package qmk
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SourcePos is a location in a keycode string. Offset is zero based, Line and
+// Column start at 1.
+type SourcePos struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p SourcePos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+type TokenKind int
+
+const (
+	TokenIdent TokenKind = iota
+	TokenNumber
+	TokenLParen
+	TokenRParen
+	TokenComma
+	TokenPipe
+	TokenEOF
+)
+
+var punctuation = map[rune]TokenKind{
+	'(': TokenLParen,
+	')': TokenRParen,
+	',': TokenComma,
+	'|': TokenPipe,
+}
+
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  SourcePos
+}
+
+func (t Token) describe() string {
+	if t.Kind == TokenEOF {
+		return "end of keycode"
+	}
+
+	return fmt.Sprintf("'%s'", t.Text)
+}
+
+// Lex splits a keycode such as LT(1, KC_A) into tokens. The returned slice
+// always ends with a TokenEOF.
+func Lex(input string) ([]Token, error) {
+	tokens := []Token{}
+	runes := []rune(input)
+	pos := SourcePos{Offset: 0, Line: 1, Column: 1}
+
+	advance := func() {
+		if runes[pos.Offset] == '\n' {
+			pos.Line += 1
+			pos.Column = 1
+		} else {
+			pos.Column += 1
+		}
+		pos.Offset += 1
+	}
+
+	for pos.Offset < len(runes) {
+		c := runes[pos.Offset]
+		start := pos
+
+		switch {
+		case unicode.IsSpace(c):
+			advance()
+		case c == '(' || c == ')' || c == ',' || c == '|':
+			tokens = append(tokens, Token{Kind: punctuation[c], Text: string(c), Pos: start})
+			advance()
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			kind := TokenIdent
+			if unicode.IsDigit(c) {
+				kind = TokenNumber
+			}
+
+			for pos.Offset < len(runes) && isIdentRune(runes[pos.Offset]) {
+				advance()
+			}
+
+			tokens = append(tokens, Token{Kind: kind, Text: string(runes[start.Offset:pos.Offset]), Pos: start})
+		default:
+			return tokens, fmt.Errorf("%s: unexpected character '%c'", start, c)
+		}
+	}
+
+	return append(tokens, Token{Kind: TokenEOF, Pos: pos}), nil
+}
+
+func isIdentRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// KeycodeNode is a parsed keycode expression.
+type KeycodeNode interface {
+	Pos() SourcePos
+}
+
+// BasicKeycodeNode is a plain keycode such as KC_A, Name holds it without the
+// KC_ prefix.
+type BasicKeycodeNode struct {
+	Start SourcePos
+	Name  string
+}
+
+// ModifierNode sends Key with Mods held, as in LSFT(KC_A) or C(KC_Z).
+type ModifierNode struct {
+	Start    SourcePos
+	Function string
+	Mods     ModMask
+	Key      KeycodeNode
+}
+
+// ModTapNode taps Key and holds Mods, as in LSFT_T(KC_A) or MT(MOD_LCTL, KC_A).
+type ModTapNode struct {
+	Start    SourcePos
+	Function string
+	Mods     ModMask
+	Key      KeycodeNode
+}
+
+// OneShotModNode is OSM(mods).
+type OneShotModNode struct {
+	Start SourcePos
+	Mods  ModMask
+}
+
+// LayerTapNode taps Key and holds Layer, as in LT(1, KC_SPC).
+type LayerTapNode struct {
+	Start SourcePos
+	Layer int
+	Key   KeycodeNode
+}
+
+// LayerFunctionNode is one of the single argument layer keys MO, TO, TG, DF
+// and OSL.
+type LayerFunctionNode struct {
+	Start    SourcePos
+	Function string
+	Layer    int
+}
+
+// QuantumNode is a QK_ or RGB_ keycode.
+type QuantumNode struct {
+	Start SourcePos
+	Name  string
+}
+
+// UnknownNode is anything the parser has no rule for. Args are kept so the
+// expression can still be walked.
+type UnknownNode struct {
+	Start SourcePos
+	Name  string
+	Args  []KeycodeNode
+}
+
+func (n BasicKeycodeNode) Pos() SourcePos  { return n.Start }
+func (n ModifierNode) Pos() SourcePos      { return n.Start }
+func (n ModTapNode) Pos() SourcePos        { return n.Start }
+func (n OneShotModNode) Pos() SourcePos    { return n.Start }
+func (n LayerTapNode) Pos() SourcePos      { return n.Start }
+func (n LayerFunctionNode) Pos() SourcePos { return n.Start }
+func (n QuantumNode) Pos() SourcePos       { return n.Start }
+func (n UnknownNode) Pos() SourcePos       { return n.Start }
+
+var layerFunctions = []string{"MO", "TO", "TG", "DF", "OSL"}
+
+// keycodeAliases are the shorthands QMK keymaps use for blank keys.
+var keycodeAliases = map[string]string{
+	"_______": "TRNS",
+	"XXXXXXX": "NO",
+}
+
+type keycodeParser struct {
+	tokens []Token
+	pos    int
+}
+
+// ParseKeycode parses a single keycode expression into its AST.
+func ParseKeycode(input string) (KeycodeNode, error) {
+	tokens, err := Lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := keycodeParser{tokens: tokens}
+	node, err := p.parseKeycode()
+	if err != nil {
+		return nil, err
+	}
+
+	if next := p.peek(); next.Kind != TokenEOF {
+		return nil, fmt.Errorf("%s: unexpected %s after keycode", next.Pos, next.describe())
+	}
+
+	return node, nil
+}
+
+func (p *keycodeParser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *keycodeParser) next() Token {
+	token := p.tokens[p.pos]
+	if token.Kind != TokenEOF {
+		p.pos += 1
+	}
+
+	return token
+}
+
+func (p *keycodeParser) expect(kind TokenKind, what string) (Token, error) {
+	token := p.next()
+	if token.Kind != kind {
+		return token, fmt.Errorf("%s: expected %s, got %s", token.Pos, what, token.describe())
+	}
+
+	return token, nil
+}
+
+func (p *keycodeParser) parseKeycode() (KeycodeNode, error) {
+	token := p.next()
+
+	if token.Kind == TokenNumber {
+		return UnknownNode{Start: token.Pos, Name: token.Text}, nil
+	}
+
+	if token.Kind != TokenIdent {
+		return nil, fmt.Errorf("%s: expected keycode, got %s", token.Pos, token.describe())
+	}
+
+	if p.peek().Kind == TokenLParen {
+		p.next()
+		return p.parseFunction(token)
+	}
+
+	name := token.Text
+	if alias, ok := keycodeAliases[name]; ok {
+		return BasicKeycodeNode{Start: token.Pos, Name: alias}, nil
+	}
+
+	switch {
+	case strings.HasPrefix(name, "KC_"):
+		return BasicKeycodeNode{Start: token.Pos, Name: strings.TrimPrefix(name, "KC_")}, nil
+	case strings.HasPrefix(name, "QK_") || strings.HasPrefix(name, "RGB_"):
+		return QuantumNode{Start: token.Pos, Name: name}, nil
+	}
+
+	return UnknownNode{Start: token.Pos, Name: name}, nil
+}
+
+// parseFunction parses name(...), the opening parenthesis has already been
+// consumed.
+func (p *keycodeParser) parseFunction(name Token) (KeycodeNode, error) {
+	node, err := p.parseArguments(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.expect(TokenRParen, fmt.Sprintf("')' to close %s", name.Text)); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+func (p *keycodeParser) parseArguments(name Token) (KeycodeNode, error) {
+	if mods, ok := modFunctions[name.Text]; ok {
+		key, err := p.parseKeycode()
+		return ModifierNode{Start: name.Pos, Function: name.Text, Mods: mods, Key: key}, err
+	}
+
+	if mods, ok := modTapFunctions[name.Text]; ok {
+		key, err := p.parseKeycode()
+		return ModTapNode{Start: name.Pos, Function: name.Text, Mods: mods, Key: key}, err
+	}
+
+	switch {
+	case name.Text == "MT":
+		return p.parseModTap(name)
+	case name.Text == "LT":
+		return p.parseLayerTap(name)
+	case name.Text == "OSM":
+		mods, err := p.parseModMask()
+		return OneShotModNode{Start: name.Pos, Mods: mods}, err
+	case slices.Contains(layerFunctions, name.Text):
+		layer, err := p.parseLayer()
+		return LayerFunctionNode{Start: name.Pos, Function: name.Text, Layer: layer}, err
+	}
+
+	return p.parseUnknownFunction(name)
+}
+
+func (p *keycodeParser) parseModTap(name Token) (KeycodeNode, error) {
+	mods, err := p.parseModMask()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.expect(TokenComma, "',' after MT modifiers"); err != nil {
+		return nil, err
+	}
+
+	key, err := p.parseKeycode()
+	if err != nil {
+		return nil, err
+	}
+
+	return ModTapNode{Start: name.Pos, Function: name.Text, Mods: mods, Key: key}, nil
+}
+
+func (p *keycodeParser) parseLayerTap(name Token) (KeycodeNode, error) {
+	layer, err := p.parseLayer()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.expect(TokenComma, "',' after LT layer"); err != nil {
+		return nil, err
+	}
+
+	key, err := p.parseKeycode()
+	if err != nil {
+		return nil, err
+	}
+
+	return LayerTapNode{Start: name.Pos, Layer: layer, Key: key}, nil
+}
+
+func (p *keycodeParser) parseUnknownFunction(name Token) (KeycodeNode, error) {
+	node := UnknownNode{Start: name.Pos, Name: name.Text}
+
+	if p.peek().Kind == TokenRParen {
+		return node, nil
+	}
+
+	for {
+		arg, err := p.parseKeycode()
+		if err != nil {
+			return nil, err
+		}
+		node.Args = append(node.Args, arg)
+
+		if p.peek().Kind != TokenComma {
+			return node, nil
+		}
+		p.next()
+	}
+}
+
+func (p *keycodeParser) parseLayer() (int, error) {
+	token, err := p.expect(TokenNumber, "layer number")
+	if err != nil {
+		return 0, err
+	}
+
+	layer, err := strconv.Atoi(token.Text)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid layer number '%s'", token.Pos, token.Text)
+	}
+
+	return layer, nil
+}
+
+// parseModMask parses a MOD_* mask such as MOD_LCTL | MOD_LSFT.
+func (p *keycodeParser) parseModMask() (ModMask, error) {
+	var mods ModMask
+
+	for {
+		token, err := p.expect(TokenIdent, "modifier")
+		if err != nil {
+			return 0, err
+		}
+
+		mod, ok := modMasks[strings.TrimPrefix(token.Text, "MOD_")]
+		if !ok || !strings.HasPrefix(token.Text, "MOD_") {
+			return 0, fmt.Errorf("%s: unknown modifier %s", token.Pos, token.Text)
+		}
+		mods |= mod
+
+		if p.peek().Kind != TokenPipe {
+			return mods, nil
+		}
+		p.next()
+	}
+}
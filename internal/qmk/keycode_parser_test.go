@@ -0,0 +1,100 @@
+package qmk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseKeycodeBasic(t *testing.T) {
+	node, err := ParseKeycode("KC_LEFT_BRACKET")
+	NoError(t, err)
+	Equal[KeycodeNode](t, BasicKeycodeNode{Start: SourcePos{Offset: 0, Line: 1, Column: 1}, Name: "LEFT_BRACKET"}, node)
+
+	node, err = ParseKeycode("_______")
+	NoError(t, err)
+	Equal[KeycodeNode](t, BasicKeycodeNode{Start: SourcePos{Offset: 0, Line: 1, Column: 1}, Name: "TRNS"}, node)
+}
+
+func TestParseKeycodeLayerTap(t *testing.T) {
+	node, err := ParseKeycode("LT(1, KC_A)")
+	NoError(t, err)
+
+	expected := LayerTapNode{
+		Start: SourcePos{Offset: 0, Line: 1, Column: 1},
+		Layer: 1,
+		Key:   BasicKeycodeNode{Start: SourcePos{Offset: 6, Line: 1, Column: 7}, Name: "A"},
+	}
+	Equal[KeycodeNode](t, expected, node)
+}
+
+func TestParseKeycodeNested(t *testing.T) {
+	node, err := ParseKeycode("LSFT(LCTL(KC_A))")
+	NoError(t, err)
+
+	expected := ModifierNode{
+		Start:    SourcePos{Offset: 0, Line: 1, Column: 1},
+		Function: "LSFT",
+		Mods:     ModLSft,
+		Key: ModifierNode{
+			Start:    SourcePos{Offset: 5, Line: 1, Column: 6},
+			Function: "LCTL",
+			Mods:     ModLCtl,
+			Key:      BasicKeycodeNode{Start: SourcePos{Offset: 10, Line: 1, Column: 11}, Name: "A"},
+		},
+	}
+	Equal[KeycodeNode](t, expected, node)
+
+	queue := CreateQueue("LSFT(LCTL(KC_A))")
+	res, err := queue.Parse()
+	NoError(t, err)
+	Equal(t, KC{Default: "a", Shift: "A", Mods: ModLCtl | ModLSft}, res)
+}
+
+func TestParseKeycodeModTap(t *testing.T) {
+	node, err := ParseKeycode("MT(MOD_LCTL | MOD_LSFT, KC_A)")
+	NoError(t, err)
+
+	expected := ModTapNode{
+		Start:    SourcePos{Offset: 0, Line: 1, Column: 1},
+		Function: "MT",
+		Mods:     ModLCtl | ModLSft,
+		Key:      BasicKeycodeNode{Start: SourcePos{Offset: 24, Line: 1, Column: 25}, Name: "A"},
+	}
+	Equal[KeycodeNode](t, expected, node)
+}
+
+func TestParseKeycodeUnknown(t *testing.T) {
+	node, err := ParseKeycode("ANY(MY_MACRO)")
+	NoError(t, err)
+
+	unknown, ok := node.(UnknownNode)
+	Equal(t, true, ok)
+	Equal(t, "ANY", unknown.Name)
+	Equal(t, 1, len(unknown.Args))
+	arg, ok := unknown.Args[0].(UnknownNode)
+	Equal(t, true, ok)
+	Equal(t, "MY_MACRO", arg.Name)
+	Equal(t, SourcePos{Offset: 4, Line: 1, Column: 5}, arg.Pos())
+
+	queue := CreateQueue("ANY(MY_MACRO)")
+	res, err := queue.Parse()
+	NoError(t, err)
+	Equal(t, "ANY(MY_MACRO)", res.Default)
+}
+
+func TestParseKeycodeErrors(t *testing.T) {
+	_, err := ParseKeycode("LT(1, KC_A")
+	ErrorEqual(t, errors.New("1:11: expected ')' to close LT, got end of keycode"), err)
+
+	_, err = ParseKeycode("LT(KC_A, 1)")
+	ErrorEqual(t, errors.New("1:4: expected layer number, got 'KC_A'"), err)
+
+	_, err = ParseKeycode("MT(MOD_FOO, KC_A)")
+	ErrorEqual(t, errors.New("1:4: unknown modifier MOD_FOO"), err)
+
+	_, err = ParseKeycode("KC_A)")
+	ErrorEqual(t, errors.New("1:5: unexpected ')' after keycode"), err)
+
+	_, err = ParseKeycode("KC_A + KC_B")
+	ErrorEqual(t, errors.New("1:6: unexpected character '+'"), err)
+}
@@ -0,0 +1,271 @@
+package qmk
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hjson/hjson-go/v4"
+)
+
+// bundledKeycodeSpecs holds a subset of QMK's data/constants/keycodes spec so
+// the analyzer works without a QMK checkout.
+//
+//go:embed keycodes/*.hjson
+var bundledKeycodeSpecs embed.FS
+
+var keycodeSpecFileRegex = regexp.MustCompile(`^keycodes_(\d+\.\d+\.\d+)(?:_\w+)?\.hjson$`)
+
+// deleteKeycode marks a keycode as removed in a later spec version.
+const deleteKeycode = "!delete!"
+
+var (
+	keycodeSpecMutex sync.Mutex
+	keycodeSpecFS    fs.FS
+	keycodeTables    = map[string]*KeycodeTable{}
+)
+
+// KeycodeTable is the QMK keycode spec merged up to Version, indexed by
+// keycode name and alias.
+type KeycodeTable struct {
+	Version  string
+	keycodes map[string]Keycode
+}
+
+func (t *KeycodeTable) Lookup(name string) (Keycode, bool) {
+	if t == nil {
+		return Keycode{}, false
+	}
+
+	keycode, ok := t.keycodes[name]
+	return keycode, ok
+}
+
+// SetKeycodeSpecDir loads keycode specs from dir, e.g.
+// qmk_firmware/data/constants/keycodes, instead of the bundled subset.
+func SetKeycodeSpecDir(dir string) error {
+	fsys := os.DirFS(dir)
+	versions, err := KeycodeVersions(fsys)
+	if err != nil {
+		return err
+	}
+
+	if len(versions) == 0 {
+		return fmt.Errorf("no keycode spec files found in %s", dir)
+	}
+
+	keycodeSpecMutex.Lock()
+	defer keycodeSpecMutex.Unlock()
+
+	keycodeSpecFS = fsys
+	keycodeTables = map[string]*KeycodeTable{}
+
+	return nil
+}
+
+func currentKeycodeSpecFS() fs.FS {
+	if keycodeSpecFS == nil {
+		sub, err := fs.Sub(bundledKeycodeSpecs, "keycodes")
+		if err != nil {
+			panic(err)
+		}
+		keycodeSpecFS = sub
+	}
+
+	return keycodeSpecFS
+}
+
+// GetKeycodeTable returns the keycode table for version, loading it on first
+// use. An empty version means the latest available.
+func GetKeycodeTable(version string) (*KeycodeTable, error) {
+	keycodeSpecMutex.Lock()
+	defer keycodeSpecMutex.Unlock()
+
+	if table, ok := keycodeTables[version]; ok {
+		return table, nil
+	}
+
+	table, err := LoadKeycodeTable(currentKeycodeSpecFS(), version)
+	if err != nil {
+		return nil, err
+	}
+
+	keycodeTables[version] = table
+	return table, nil
+}
+
+// defaultKeycodeTable is the latest keycode table, or the latest bundled one
+// if the spec directory can't be loaded, since keycodes only exist through it.
+func defaultKeycodeTable() *KeycodeTable {
+	table, err := GetKeycodeTable("")
+	if err == nil {
+		return table
+	}
+
+	fmt.Printf("WARN: could not load keycode spec, using the bundled one: %s\n", err.Error())
+	sub, err := fs.Sub(bundledKeycodeSpecs, "keycodes")
+	if err != nil {
+		panic(err)
+	}
+
+	table, err = LoadKeycodeTable(sub, "")
+	if err != nil {
+		panic(err)
+	}
+
+	return table
+}
+
+// KeycodeVersions lists the spec versions found in fsys, oldest first.
+func KeycodeVersions(fsys fs.FS) ([]string, error) {
+	files, err := fs.Glob(fsys, "keycodes_*.hjson")
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	for _, file := range files {
+		match := keycodeSpecFileRegex.FindStringSubmatch(path.Base(file))
+		if match != nil && !slices.Contains(versions, match[1]) {
+			versions = append(versions, match[1])
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return compareVersions(versions[i], versions[j]) < 0
+	})
+
+	return versions, nil
+}
+
+// LoadKeycodeTable merges every spec file up to and including version, later
+// versions overriding earlier ones, the same way QMK builds its keycode list.
+func LoadKeycodeTable(fsys fs.FS, version string) (*KeycodeTable, error) {
+	versions, err := KeycodeVersions(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no keycode spec files found")
+	}
+
+	if version == "" {
+		version = versions[len(versions)-1]
+	}
+
+	if compareVersions(version, versions[0]) < 0 {
+		return nil, fmt.Errorf("no keycode spec for version %s, oldest is %s", version, versions[0])
+	}
+
+	merged := map[string]Keycode{}
+	for _, specVersion := range versions {
+		if compareVersions(specVersion, version) > 0 {
+			break
+		}
+
+		files, err := fs.Glob(fsys, fmt.Sprintf("keycodes_%s*.hjson", specVersion))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			match := keycodeSpecFileRegex.FindStringSubmatch(path.Base(file))
+			if match == nil || match[1] != specVersion {
+				continue
+			}
+
+			err := mergeKeycodeSpec(fsys, file, merged)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	codes := []string{}
+	for code := range merged {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	table := &KeycodeTable{Version: version, keycodes: map[string]Keycode{}}
+	for _, code := range codes {
+		keycode := merged[code]
+		table.keycodes[keycode.Key] = keycode
+		for _, alias := range keycode.Aliases {
+			table.keycodes[alias] = keycode
+		}
+	}
+
+	return table, nil
+}
+
+func mergeKeycodeSpec(fsys fs.FS, file string, merged map[string]Keycode) error {
+	b, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return err
+	}
+
+	var spec struct {
+		Keycodes map[string]any `json:"keycodes"`
+	}
+
+	err = hjson.Unmarshal(b, &spec)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	for code, value := range spec.Keycodes {
+		if value == deleteKeycode {
+			delete(merged, code)
+			continue
+		}
+
+		entry, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("%s: keycode %s: %w", file, code, err)
+		}
+
+		var keycode Keycode
+		err = json.Unmarshal(entry, &keycode)
+		if err != nil {
+			return fmt.Errorf("%s: keycode %s: %w", file, code, err)
+		}
+
+		merged[code] = keycode
+	}
+
+	return nil
+}
+
+// compareVersions compares dotted version numbers such as 0.0.1 and 0.0.10.
+func compareVersions(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aVal, bVal := 0, 0
+		if i < len(aParts) {
+			aVal, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bVal, _ = strconv.Atoi(bParts[i])
+		}
+
+		if aVal != bVal {
+			return aVal - bVal
+		}
+	}
+
+	return 0
+}
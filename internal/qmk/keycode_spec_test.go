@@ -0,0 +1,158 @@
+package qmk
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestKeycodeSpecLookup(t *testing.T) {
+	table, err := GetKeycodeTable("")
+	NoError(t, err)
+
+	keycode, ok := table.Lookup("KC_VOLU")
+	Equal(t, true, ok)
+	Equal(t, "KC_AUDIO_VOL_UP", keycode.Key)
+	Equal(t, "Volume Up", keycode.Label)
+
+	for _, keycode := range []string{"KC_F13", "KC_INT1", "KC_LNG1", "KC_PWR", "QK_BOOT", "MS_BTN1"} {
+		_, ok := table.Lookup(keycode)
+		Equal(t, true, ok)
+	}
+}
+
+func TestKeycodeSpecParse(t *testing.T) {
+	keys, err := ParseLayer([]string{"KC_F13", "KC_MUTE", "QK_BOOT", "MS_WHLU", "KC_A"})
+	NoError(t, err)
+
+	expected := []KC{
+		{Default: "F13"},
+		{Default: "Mute"},
+		{Default: "Bootloader"},
+		{Default: "Wheel Up"},
+		{Default: "a", Shift: "A"},
+	}
+	ArrayEqual(t, expected, keys)
+}
+
+func TestKeycodeSpecVersions(t *testing.T) {
+	versions, err := KeycodeVersions(currentKeycodeSpecFS())
+	NoError(t, err)
+	ArrayEqual(t, []string{"0.0.1", "0.0.4"}, versions)
+
+	// mouse keys were renamed to MS_ in 0.0.4
+	table, err := GetKeycodeTable("0.0.1")
+	NoError(t, err)
+	_, ok := table.Lookup("MS_BTN1")
+	Equal(t, false, ok)
+	_, ok = table.Lookup("KC_MS_BTN1")
+	Equal(t, true, ok)
+
+	table, err = GetKeycodeTable("0.0.3")
+	NoError(t, err)
+	Equal(t, "0.0.3", table.Version)
+	_, ok = table.Lookup("MS_BTN1")
+	Equal(t, false, ok)
+
+	_, err = GetKeycodeTable("0.0.0")
+	ErrorEqual(t, errors.New("no keycode spec for version 0.0.0, oldest is 0.0.1"), err)
+}
+
+func TestKeycodeSpecMerge(t *testing.T) {
+	fsys := fstest.MapFS{
+		"keycodes_0.0.1.hjson": {Data: []byte(`{
+			// comments and unquoted keys are fine in hjson
+			keycodes: {
+				"0x0004": {group: "basic", key: "KC_A", label: "A"}
+				"0x0005": {group: "basic", key: "KC_B", label: "B"}
+			}
+		}`)},
+		"keycodes_0.0.2_basic.hjson": {Data: []byte(`{
+			keycodes: {
+				"0x0004": {group: "basic", key: "KC_A", label: "Alpha", aliases: ["KC_ALPHA"]}
+				"0x0005": "!delete!"
+			}
+		}`)},
+		"keycodes_0.0.10_basic.hjson": {Data: []byte(`{
+			keycodes: {
+				"0x0006": {group: "basic", key: "KC_C", label: "C"}
+			}
+		}`)},
+	}
+
+	versions, err := KeycodeVersions(fsys)
+	NoError(t, err)
+	ArrayEqual(t, []string{"0.0.1", "0.0.2", "0.0.10"}, versions)
+
+	table, err := LoadKeycodeTable(fsys, "0.0.1")
+	NoError(t, err)
+	keycode, _ := table.Lookup("KC_A")
+	Equal(t, "A", keycode.Label)
+	_, ok := table.Lookup("KC_B")
+	Equal(t, true, ok)
+
+	table, err = LoadKeycodeTable(fsys, "0.0.2")
+	NoError(t, err)
+	keycode, _ = table.Lookup("KC_ALPHA")
+	Equal(t, "Alpha", keycode.Label)
+	_, ok = table.Lookup("KC_B")
+	Equal(t, false, ok)
+	_, ok = table.Lookup("KC_C")
+	Equal(t, false, ok)
+
+	table, err = LoadKeycodeTable(fsys, "")
+	NoError(t, err)
+	Equal(t, "0.0.10", table.Version)
+	_, ok = table.Lookup("KC_C")
+	Equal(t, true, ok)
+}
+
+func TestKeycodeSpecDecidesKeycodes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"keycodes_0.0.1.hjson": {Data: []byte(`{
+			keycodes: {
+				"0x0004": {group: "basic", key: "KC_A", label: "A"}
+				"0x0028": {group: "basic", key: "KC_ENTER", label: "Enter", aliases: ["KC_ENT"]}
+			}
+		}`)},
+		"keycodes_0.0.2.hjson": {Data: []byte(`{
+			keycodes: {
+				"0x0028": "!delete!"
+			}
+		}`)},
+	}
+
+	table, err := LoadKeycodeTable(fsys, "0.0.1")
+	NoError(t, err)
+	keys, err := ParseLayerWithKeycodes([]string{"KC_ENT", "KC_A"}, table)
+	NoError(t, err)
+	ArrayEqual(t, []KC{{Default: "enter"}, {Default: "a", Shift: "A"}}, keys)
+
+	// a keycode the version removed is unknown, whatever it types otherwise
+	table, err = LoadKeycodeTable(fsys, "0.0.2")
+	NoError(t, err)
+	keys, err = ParseLayerWithKeycodes([]string{"KC_ENT"}, table)
+	NoError(t, err)
+	ArrayEqual(t, []KC{{Default: "ENT"}}, keys)
+
+	// shifted symbols and older names resolve through the keys they stand for
+	keys, err = ParseLayer([]string{"KC_TILD", "KC_DQT", "KC_RAGR", "KC_PCMM"})
+	NoError(t, err)
+	ArrayEqual(t, []KC{{Default: "~"}, {Default: "\""}, {HoldMods: ModRAlt}, {Default: ","}}, keys)
+}
+
+func TestApplyKeymapKeycodeVersion(t *testing.T) {
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	// KC_BTN1 was renamed to MS_BTN1 in 0.0.4
+	keymap := KeymapData{KeycodeVersion: "0.0.1", Layers: [][]string{{"KC_BTN1"}}}
+	keyboard := Keyboard{Keys: make([]Key, 1)}
+	NoError(t, q.ApplyKeymap(&keyboard, &keymap, 0))
+	Equal(t, "Mouse 1", keyboard.Keys[0].Keycap.Main)
+
+	keymap.KeycodeVersion = ""
+	keyboard = Keyboard{Keys: make([]Key, 1)}
+	NoError(t, q.ApplyKeymap(&keyboard, &keymap, 0))
+	Equal(t, "BTN1", keyboard.Keys[0].Keycap.Main)
+}
@@ -1,248 +1,143 @@
 package qmk
 
 var (
-	keycodes = map[string]KC{
-		"1": {Default: "1", Shift: "!"},
-		"2": {Default: "2", Shift: "@"},
-		"3": {Default: "3", Shift: "#"},
-		"4": {Default: "4", Shift: "$"},
-		"5": {Default: "5", Shift: "%"},
-		"6": {Default: "6", Shift: "^"},
-		"7": {Default: "7", Shift: "&"},
-		"8": {Default: "8", Shift: "*"},
-		"9": {Default: "9", Shift: "("},
-		"0": {Default: "0", Shift: ")"},
-
-		"MINS":  {Default: "-", Shift: "_"},
-		"MINUS": {Default: "-", Shift: "_"},
-
-		"EQUAL": {Default: "=", Shift: "+"},
-		"EQL":   {Default: "=", Shift: "+"},
-
-		"LEFT_BRACKET": {Default: "[", Shift: "{"},
-		"LBRC":         {Default: "[", Shift: "{"},
-
-		"RIGHT_BRACKET": {Default: "]", Shift: "}"},
-		"RBRC":          {Default: "]", Shift: "}"},
-
-		"BACKSLASH": {Default: "\\", Shift: "|"},
-		"BSLS":      {Default: "\\", Shift: "|"},
-
-		"NONUS_HASH": {Default: "#", Shift: "~"},
-		"NUSH":       {Default: "#", Shift: "~"},
-
-		"SEMICOLON": {Default: ";", Shift: ":"},
-		"SCLN":      {Default: ";", Shift: ":"},
-
-		"QUOTE": {Default: "'", Shift: "\""},
-		"QUOT":  {Default: "'", Shift: "\""},
-
-		"GRAVE": {Default: "`", Shift: "~"},
-		"GRV":   {Default: "`", Shift: "~"},
-
-		"COMMA": {Default: ",", Shift: "<"},
-		"COMM":  {Default: ",", Shift: "<"},
-
-		"DOT": {Default: ".", Shift: ">"},
-
-		"SLASH": {Default: "/", Shift: "?"},
-		"SLSH":  {Default: "/", Shift: "?"},
-
-		"ENTER": {Default: "enter"},
-		"ENT":   {Default: "enter"},
-
-		"ESCAPE": {Default: "esc"},
-		"ESC":    {Default: "esc"},
-
-		"BACKSPACE": {Default: "back space"},
-		"BSPC":      {Default: "back space"},
-
-		"SPACE": {Default: "space"},
-		"SPC":   {Default: "space"},
-
-		"DELETE": {Default: "del"},
-		"DEL":    {Default: "del"},
-
-		"TAB": {Default: "tab"},
-
-		"NO": {},
-
-		"TRANSPARENT": {Default: "TRANS"},
-		"TRNS":        {Default: "TRANS"},
-
-		"UP":    {Default: "up"},
-		"DOWN":  {Default: "down"},
-		"LEFT":  {Default: "left"},
-		"RIGHT": {Default: "right"},
-		"RGHT":  {Default: "right"},
-
-		"HOME": {Default: "home"},
-		"END":  {Default: "end"},
-
-		"INSERT": {Default: "ins"},
-		"INS":    {Default: "ins"},
-
-		"PAGE_UP": {Default: "page up"},
-		"PGUP":    {Default: "page up"},
-
-		"PAGE_DOWN": {Default: "page down"},
-		"PGDN":      {Default: "page down"},
-
-		"TILDE": {Default: "~"},
-		"TILD":  {Default: "~"},
-
-		"EXCLAIM": {Default: "!"},
-		"EXLM":    {Default: "!"},
-
-		"AT": {Default: "@"},
-
-		"HASH": {Default: "#"},
-
-		"DOLLAR": {Default: "$"},
-		"DLR":    {Default: "$"},
-
-		"PERCENT": {Default: "%"},
-		"PERC":    {Default: "%"},
-
-		"CIRCUMCFLEX": {Default: "^"},
-		"CIRC":        {Default: "^"},
-
-		"AMPERSAND": {Default: "&"},
-		"AMPR":      {Default: "&"},
-
-		"ASTERISK": {Default: "*"},
-		"ASTR":     {Default: "*"},
-
-		"LEFT_PAREN": {Default: "("},
-		"LPRN":       {Default: "("},
-
-		"RIGHT_PAREN": {Default: ")"},
-		"RPRN":        {Default: ")"},
-
-		"UNDERSCORE": {Default: "_"},
-		"UNDS":       {Default: "_"},
-
-		"PLUS": {Default: "+"},
-
-		"LEFT_CURLY_BRACE": {Default: "{"},
-		"LCBR":             {Default: "{"},
-
-		"RIGHT_CURLY_BRACE": {Default: "}"},
-		"RCBR":              {Default: "}"},
-
-		"PIPE": {Default: "|"},
-
-		"COLON": {Default: ":"},
-		"COLN":  {Default: ":"},
-
-		"DOUBLE_QUOTE": {Default: "\""},
-		"DQUO":         {Default: "\""},
-		"DQT":          {Default: "\""},
-
-		"LEFT_ANGLE_BRACKET": {Default: "<"},
-		"LABK":               {Default: "<"},
-		"LT":                 {Default: "<"},
-
-		"RIGHT_ANGLE_BRACKET": {Default: ">"},
-		"RABK":                {Default: ">"},
-		"RT":                  {Default: ">"},
-
-		"QUESTION": {Default: "?"},
-		"QUES":     {Default: "?"},
-
-		"KP_COMM": {Default: ","},
-		"PCMM":    {Default: ","},
-
-		"KP_SLASH": {Default: "/"},
-		"PSLS":     {Default: "/"},
-
-		"KP_ASTERISK": {Default: "*"},
-		"PAST":        {Default: "*"},
-
-		"KP_MINUS": {Default: "-"},
-		"PMNS":     {Default: "-"},
+	// keyOutputs is what the keys of the QMK keycode spec type where that isn't
+	// their spec label: the shifted value of symbol keys, the names the
+	// analyzer gives to whitespace and editing keys, and the modifiers held by
+	// modifier keys. It is keyed by the spec's name for the key, so every alias
+	// of a key shares its entry and the spec decides which keys exist.
+	keyOutputs = map[string]KC{
+		"KC_1": {Default: "1", Shift: "!"},
+		"KC_2": {Default: "2", Shift: "@"},
+		"KC_3": {Default: "3", Shift: "#"},
+		"KC_4": {Default: "4", Shift: "$"},
+		"KC_5": {Default: "5", Shift: "%"},
+		"KC_6": {Default: "6", Shift: "^"},
+		"KC_7": {Default: "7", Shift: "&"},
+		"KC_8": {Default: "8", Shift: "*"},
+		"KC_9": {Default: "9", Shift: "("},
+		"KC_0": {Default: "0", Shift: ")"},
+
+		"KC_MINUS":         {Default: "-", Shift: "_"},
+		"KC_EQUAL":         {Default: "=", Shift: "+"},
+		"KC_LEFT_BRACKET":  {Default: "[", Shift: "{"},
+		"KC_RIGHT_BRACKET": {Default: "]", Shift: "}"},
+		"KC_BACKSLASH":     {Default: "\\", Shift: "|"},
+		"KC_NONUS_HASH":    {Default: "#", Shift: "~"},
+		"KC_SEMICOLON":     {Default: ";", Shift: ":"},
+		"KC_QUOTE":         {Default: "'", Shift: "\""},
+		"KC_GRAVE":         {Default: "`", Shift: "~"},
+		"KC_COMMA":         {Default: ",", Shift: "<"},
+		"KC_DOT":           {Default: ".", Shift: ">"},
+		"KC_SLASH":         {Default: "/", Shift: "?"},
+
+		"KC_ENTER":     {Default: "enter"},
+		"KC_ESCAPE":    {Default: "esc"},
+		"KC_BACKSPACE": {Default: "back space"},
+		"KC_SPACE":     {Default: "space"},
+		"KC_DELETE":    {Default: "del"},
+		"KC_TAB":       {Default: "tab"},
+
+		"KC_NO":          {},
+		"KC_TRANSPARENT": {Default: "TRANS"},
+
+		"KC_UP":    {Default: "up"},
+		"KC_DOWN":  {Default: "down"},
+		"KC_LEFT":  {Default: "left"},
+		"KC_RIGHT": {Default: "right"},
+
+		"KC_HOME":      {Default: "home"},
+		"KC_END":       {Default: "end"},
+		"KC_INSERT":    {Default: "ins"},
+		"KC_PAGE_UP":   {Default: "page up"},
+		"KC_PAGE_DOWN": {Default: "page down"},
+
+		"KC_KP_ENTER": {Default: "enter"},
+
+		"KC_LEFT_GUI":  {Default: "lgui", HoldMods: ModLGui},
+		"KC_RIGHT_GUI": {Default: "rgui", HoldMods: ModRGui},
+
+		"KC_LEFT_CTRL":   {HoldMods: ModLCtl},
+		"KC_RIGHT_CTRL":  {HoldMods: ModRCtl},
+		"KC_LEFT_SHIFT":  {HoldMods: ModLSft},
+		"KC_RIGHT_SHIFT": {HoldMods: ModRSft},
+		"KC_LEFT_ALT":    {HoldMods: ModLAlt},
+		"KC_RIGHT_ALT":   {HoldMods: ModRAlt},
+	}
 
-		"KP_PLUS": {Default: "+"},
-		"PPLS":    {Default: "+"},
+	// shiftedKeycodes are QMK's US ANSI shifted symbols, which are the key
+	// they shift wrapped in S() rather than keycodes of their own, so they
+	// aren't in the spec. They type the shifted value of that key.
+	shiftedKeycodes = map[string]string{
+		"KC_TILDE": "KC_GRAVE",
+		"KC_TILD":  "KC_GRAVE",
 
-		"KP_ENTER": {Default: "enter"},
-		"PENT":     {Default: "enter"},
+		"KC_EXCLAIM": "KC_1",
+		"KC_EXLM":    "KC_1",
 
-		"KP_DOT": {Default: "."},
-		"PDOT":   {Default: "."},
+		"KC_AT": "KC_2",
 
-		"KP_0": {Default: "0"},
-		"P0":   {Default: "0"},
+		"KC_HASH": "KC_3",
 
-		"KP_1": {Default: "1"},
-		"P1":   {Default: "1"},
+		"KC_DOLLAR": "KC_4",
+		"KC_DLR":    "KC_4",
 
-		"KP_2": {Default: "2"},
-		"P2":   {Default: "2"},
+		"KC_PERCENT": "KC_5",
+		"KC_PERC":    "KC_5",
 
-		"KP_3": {Default: "3"},
-		"P3":   {Default: "3"},
+		"KC_CIRCUMFLEX": "KC_6",
+		"KC_CIRC":       "KC_6",
 
-		"KP_4": {Default: "4"},
-		"P4":   {Default: "4"},
+		"KC_AMPERSAND": "KC_7",
+		"KC_AMPR":      "KC_7",
 
-		"KP_5": {Default: "5"},
-		"P5":   {Default: "5"},
+		"KC_ASTERISK": "KC_8",
+		"KC_ASTR":     "KC_8",
 
-		"KP_6": {Default: "6"},
-		"P6":   {Default: "6"},
+		"KC_LEFT_PAREN": "KC_9",
+		"KC_LPRN":       "KC_9",
 
-		"KP_7": {Default: "7"},
-		"P7":   {Default: "7"},
+		"KC_RIGHT_PAREN": "KC_0",
+		"KC_RPRN":        "KC_0",
 
-		"KP_8": {Default: "8"},
-		"P8":   {Default: "8"},
+		"KC_UNDERSCORE": "KC_MINUS",
+		"KC_UNDS":       "KC_MINUS",
 
-		"KP_9": {Default: "9"},
-		"P9":   {Default: "9"},
+		"KC_PLUS": "KC_EQUAL",
 
-		"LEFT_GUI": {Default: "lgui", Hold: "lgui"},
-		"LGUI":     {Default: "lgui", Hold: "lgui"},
-		"LCMD":     {Default: "lgui", Hold: "lgui"},
-		"LWIN":     {Default: "lgui", Hold: "lgui"},
+		"KC_LEFT_CURLY_BRACE": "KC_LEFT_BRACKET",
+		"KC_LCBR":             "KC_LEFT_BRACKET",
 
-		"RIGHT_GUI": {Default: "rgui", Hold: "rgui"},
-		"RGUI":      {Default: "rgui", Hold: "rgui"},
-		"RCMD":      {Default: "rgui", Hold: "rgui"},
-		"RWIN":      {Default: "rgui", Hold: "rgui"},
+		"KC_RIGHT_CURLY_BRACE": "KC_RIGHT_BRACKET",
+		"KC_RCBR":              "KC_RIGHT_BRACKET",
 
-		"LEFT_CTRL": {Hold: "lctrl"},
-		"LCTL":      {Hold: "lctrl"},
+		"KC_PIPE": "KC_BACKSLASH",
 
-		"RIGHT_CTRL": {Hold: "rctrl"},
-		"RCTL":       {Hold: "rctrl"},
+		"KC_COLON": "KC_SEMICOLON",
+		"KC_COLN":  "KC_SEMICOLON",
 
-		"LEFT_SHIFT": {Hold: "lsft"},
-		"LSFT":       {Hold: "lsft"},
+		"KC_DOUBLE_QUOTE": "KC_QUOTE",
+		"KC_DQUO":         "KC_QUOTE",
 
-		"RIGHT_SHIFT": {Hold: "rsft"},
-		"RSFT":        {Hold: "rsft"},
+		"KC_LEFT_ANGLE_BRACKET": "KC_COMMA",
+		"KC_LABK":               "KC_COMMA",
 
-		"LEFT_ALT": {Hold: "lalt"},
-		"LALT":     {Hold: "lalt"},
-		"LOPT":     {Hold: "lalt"},
+		"KC_RIGHT_ANGLE_BRACKET": "KC_DOT",
+		"KC_RABK":                "KC_DOT",
 
-		"RIGHT_ALT": {Hold: "ralt"},
-		"RALT":      {Hold: "ralt"},
-		"ROPT":      {Hold: "ralt"},
-		"RAGR":      {Hold: "ralt"},
+		"KC_QUESTION": "KC_SLASH",
+		"KC_QUES":     "KC_SLASH",
+	}
 
-		"F1":  {Default: "F1"},
-		"F2":  {Default: "F2"},
-		"F3":  {Default: "F3"},
-		"F4":  {Default: "F4"},
-		"F5":  {Default: "F5"},
-		"F6":  {Default: "F6"},
-		"F7":  {Default: "F7"},
-		"F8":  {Default: "F8"},
-		"F9":  {Default: "F9"},
-		"F10": {Default: "F10"},
-		"F11": {Default: "F11"},
-		"F12": {Default: "F12"},
+	// legacyKeycodes are names older keymaps use that the spec no longer
+	// knows, with the name that replaced them.
+	legacyKeycodes = map[string]string{
+		"KC_CIRCUMCFLEX": "KC_CIRCUMFLEX",
+		"KC_DQT":         "KC_DQUO",
+		"KC_LT":          "KC_LABK",
+		"KC_RT":          "KC_RABK",
+		"KC_NUSH":        "KC_NONUS_HASH",
+		"KC_KP_COMM":     "KC_KP_COMMA",
+		"KC_RAGR":        "KC_RIGHT_ALT",
 	}
 )
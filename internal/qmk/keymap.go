@@ -1,7 +1,6 @@
 package qmk
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -18,7 +17,14 @@ type KeymapData struct {
 	Layout        string     `json:"layout"`
 	Layers        [][]string `json:"layers"`
 	Author        string     `json:"author"`
-	Path          string
+	// KeycodeVersion pins the QMK keycode spec version the keymap was
+	// written for, the latest is used when empty.
+	KeycodeVersion string `json:"keycode_version,omitempty"`
+	// Combos and TapDances come from keymap.c sources and Vial exports,
+	// TD(n) keys refer to TapDances by index.
+	Combos    []Combo    `json:"combos,omitempty"`
+	TapDances []TapDance `json:"tap_dances,omitempty"`
+	Path      string
 }
 
 type Keycode struct {
@@ -31,8 +37,18 @@ type Keycode struct {
 func (km *KeymapData) ParseLayers() ([][]KC, error) {
 	layers := [][]KC{}
 
+	table, err := GetKeycodeTable(km.KeycodeVersion)
+	if err != nil {
+		return layers, err
+	}
+
 	for _, layer := range km.Layers {
-		parsedLayer, err := ParseLayer(layer)
+		resolved := []string{}
+		for _, keycode := range layer {
+			resolved = append(resolved, km.resolveTapDance(keycode))
+		}
+
+		parsedLayer, err := ParseLayerWithKeycodes(resolved, table)
 		if err != nil {
 			return layers, err
 		}
@@ -43,6 +59,18 @@ func (km *KeymapData) ParseLayers() ([][]KC, error) {
 	return layers, nil
 }
 
+// LoadKeymap reads a keymap in any supported format, picked by extension.
+func LoadKeymap(keymapPath string, keymapData *KeymapData) error {
+	switch path.Ext(keymapPath) {
+	case ".c":
+		return LoadKeymapFromC(keymapPath, keymapData)
+	case ".keymap":
+		return LoadKeymapFromZMK(keymapPath, keymapData)
+	}
+
+	return LoadKeymapFromJSON(keymapPath, keymapData)
+}
+
 func LoadKeymapFromJSON(jsonPath string, keymapData *KeymapData) error {
 	f, err := os.Open(jsonPath)
 	defer f.Close()
@@ -56,9 +84,9 @@ func LoadKeymapFromJSON(jsonPath string, keymapData *KeymapData) error {
 		return err
 	}
 
-	err = json.Unmarshal(b, keymapData)
+	err = DecodeConfig(b, keymapData)
 	if err != nil {
-		return err
+		return fmt.Errorf("%s: %w", jsonPath, err)
 	}
 
 	keymapData.Path = jsonPath
@@ -124,10 +152,15 @@ func (q *QMKHelper) GetKeymapData(keymap string) (KeymapData, error) {
 
 	data, ok := q.KeymapCache.Get(keymap)
 	if !ok {
-		err := LoadKeymapFromJSON(keymap, &cachedKeymap)
+		err := LoadKeymap(keymap, &cachedKeymap)
 		if err != nil {
 			return cachedKeymap, err
 		}
+
+		// keymap.c files don't say which keyboard they belong to
+		if keyboard, ok := q.firmwareKeymaps[keymap]; ok && cachedKeymap.Keyboard == "" {
+			cachedKeymap.Keyboard = keyboard
+		}
 	} else {
 		cachedKeymap, ok = data.(KeymapData)
 		if !ok {
@@ -189,5 +222,7 @@ func (q *QMKHelper) GetAllCustomKeymaps() ([]KeymapOption, error) {
 		}
 	}
 
+	keymapOptions = append(keymapOptions, q.GetFirmwareKeymaps()...)
+
 	return keymapOptions, nil
 }
@@ -0,0 +1,486 @@
+package qmk
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxDefineDepth bounds #define expansion so self referencing macros can't loop.
+const maxDefineDepth = 16
+
+var (
+	defineRegex  = regexp.MustCompile(`^\s*#\s*define\s+([A-Za-z_]\w*)(\()?\s*(.*)$`)
+	enumRegex    = regexp.MustCompile(`(?s)\benum\b[^{;]*\{([^}]*)\}`)
+	keymapsRegex = regexp.MustCompile(`\bkeymaps\s*\[[^\]]*\]\s*\[[^\]]*\]\s*\[[^\]]*\]\s*=\s*\{`)
+	arrayRegex   = regexp.MustCompile(`\b([A-Za-z_]\w*)\s*\[[^\]]*\]\s*=\s*\{([^{}]*)\}`)
+	combosRegex  = regexp.MustCompile(`\bkey_combos\s*\[[^\]]*\]\s*=\s*\{`)
+	danceRegex   = regexp.MustCompile(`\btap_dance_actions\s*\[[^\]]*\]\s*=\s*\{`)
+)
+
+// keymapSource holds the preprocessed keymap.c along with the object-like
+// #defines and enum constants needed to expand its keycodes.
+type keymapSource struct {
+	text    string
+	defines map[string]string
+	enums   map[string]int
+}
+
+// LoadKeymapFromC reads a keymap.c file, see ParseKeymapC. The keymap is
+// named after the directory holding the file, as in keymaps/<name>/keymap.c.
+func LoadKeymapFromC(cPath string, keymapData *KeymapData) error {
+	b, err := os.ReadFile(cPath)
+	if err != nil {
+		return err
+	}
+
+	err = ParseKeymapC(string(b), path.Base(path.Dir(cPath)), keymapData)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cPath, err)
+	}
+
+	keymapData.Path = cPath
+
+	return nil
+}
+
+// ParseKeymapC extracts the keymaps[][MATRIX_ROWS][MATRIX_COLS] array from a
+// QMK keymap.c, along with its key_combos and tap_dance_actions arrays. Simple
+// #define aliases and enum layer names are expanded so every keycode is one
+// the keycode parser understands.
+func ParseKeymapC(src, name string, keymapData *KeymapData) error {
+	source := preprocessKeymapC(src)
+
+	loc := keymapsRegex.FindStringIndex(source.text)
+	if loc == nil {
+		return fmt.Errorf("could not find keymaps array")
+	}
+
+	layers := map[int][]string{}
+	layout := ""
+
+	err := source.eachEntry(loc[1], "keymaps array", func(layer int, macro string, args []string, line int) error {
+		if layout == "" {
+			layout = macro
+		}
+
+		layers[layer] = args
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(layers) == 0 {
+		return fmt.Errorf("keymaps array is empty")
+	}
+
+	indexes := []int{}
+	for index := range layers {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	// layers missing from the array are all zeroes, which is KC_NO
+	keyCount := len(layers[indexes[0]])
+	keymapData.Layers = [][]string{}
+	for index := 0; index <= indexes[len(indexes)-1]; index++ {
+		keys, ok := layers[index]
+		if !ok {
+			keys = make([]string, keyCount)
+			for i := range keys {
+				keys[i] = "KC_NO"
+			}
+		}
+
+		keymapData.Layers = append(keymapData.Layers, keys)
+	}
+
+	keymapData.Combos, err = source.combos()
+	if err != nil {
+		return err
+	}
+
+	keymapData.TapDances, err = source.tapDances()
+	if err != nil {
+		return err
+	}
+
+	keymapData.Version = 1
+	keymapData.Keymap = name
+	keymapData.Layout = layout
+
+	return nil
+}
+
+// eachEntry calls fn with every MACRO(args...) entry of the array whose body
+// opens just before bodyStart. Entries are numbered like C does, following
+// [designator] = entries, and their macro and arguments are expanded.
+func (s keymapSource) eachEntry(bodyStart int, what string, fn func(index int, macro string, args []string, line int) error) error {
+	bodyEnd, err := matchingBrace(s.text, bodyStart-1, what)
+	if err != nil {
+		return err
+	}
+
+	next := 0
+	for _, entry := range splitTopLevel(s.text[bodyStart:bodyEnd]) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		line := s.line(bodyStart, entry)
+		index := next
+		if strings.HasPrefix(entry, "[") {
+			closing := strings.Index(entry, "]")
+			equals := strings.Index(entry, "=")
+			if closing == -1 || equals < closing {
+				return fmt.Errorf("line %d: malformed designator", line)
+			}
+
+			index, err = s.evalInt(strings.TrimSpace(entry[1:closing]))
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+
+			entry = strings.TrimSpace(entry[equals+1:])
+		}
+
+		open := strings.Index(entry, "(")
+		if open == -1 || !strings.HasSuffix(entry, ")") {
+			return fmt.Errorf("line %d: expected a macro call for entry %d of %s", line, index, what)
+		}
+
+		args := []string{}
+		for _, arg := range splitTopLevel(entry[open+1 : len(entry)-1]) {
+			arg = strings.TrimSpace(arg)
+			if arg == "" {
+				continue
+			}
+
+			args = append(args, s.expand(arg, 0))
+		}
+
+		err = fn(index, s.expand(strings.TrimSpace(entry[:open]), 0), args, line)
+		if err != nil {
+			return err
+		}
+
+		next = index + 1
+	}
+
+	return nil
+}
+
+// combos reads the key_combos array. COMBO(keys, output) entries refer to a
+// COMBO_END terminated array of keycodes, COMBO_ACTION entries have no
+// output keycode and are skipped.
+func (s keymapSource) combos() ([]Combo, error) {
+	combos := []Combo{}
+
+	loc := combosRegex.FindStringIndex(s.text)
+	if loc == nil {
+		return combos, nil
+	}
+
+	triggers := map[string][]string{}
+	for _, match := range arrayRegex.FindAllStringSubmatch(s.text, -1) {
+		keys := []string{}
+		for _, key := range strings.Split(match[2], ",") {
+			key = s.expand(strings.TrimSpace(key), 0)
+			if key == "" || key == "COMBO_END" {
+				continue
+			}
+
+			keys = append(keys, key)
+		}
+
+		triggers[match[1]] = keys
+	}
+
+	err := s.eachEntry(loc[1], "key_combos array", func(index int, macro string, args []string, line int) error {
+		if macro != "COMBO" {
+			return nil
+		}
+
+		if len(args) != 2 {
+			return fmt.Errorf("line %d: expected COMBO(keys, output), got %d arguments", line, len(args))
+		}
+
+		keys, ok := triggers[args[0]]
+		if !ok {
+			return fmt.Errorf("line %d: could not find combo keys '%s'", line, args[0])
+		}
+
+		if len(keys) < 2 || args[1] == "KC_NO" {
+			return nil
+		}
+
+		combos = append(combos, Combo{Keys: keys, Output: args[1]})
+		return nil
+	})
+
+	return combos, err
+}
+
+// tapDances reads the tap_dance_actions array. The double tap and layer
+// actions map onto TapDance fields, tap dances run by user functions can't be
+// followed and are kept as KC_NO so later TD(n) indexes still line up.
+func (s keymapSource) tapDances() ([]TapDance, error) {
+	tapDances := []TapDance{}
+
+	loc := danceRegex.FindStringIndex(s.text)
+	if loc == nil {
+		return tapDances, nil
+	}
+
+	byIndex := map[int]TapDance{}
+	count := 0
+
+	err := s.eachEntry(loc[1], "tap_dance_actions array", func(index int, macro string, args []string, line int) error {
+		tapDance := TapDance{OnTap: "KC_NO", OnHold: "KC_NO", OnDoubleTap: "KC_NO", OnTapHold: "KC_NO"}
+
+		switch macro {
+		case "ACTION_TAP_DANCE_DOUBLE":
+			if len(args) != 2 {
+				return fmt.Errorf("line %d: expected %s(kc1, kc2), got %d arguments", line, macro, len(args))
+			}
+			tapDance.OnTap, tapDance.OnDoubleTap = args[0], args[1]
+		case "ACTION_TAP_DANCE_LAYER_MOVE", "ACTION_TAP_DANCE_LAYER_TOGGLE":
+			if len(args) != 2 {
+				return fmt.Errorf("line %d: expected %s(kc, layer), got %d arguments", line, macro, len(args))
+			}
+
+			function := "TO"
+			if macro == "ACTION_TAP_DANCE_LAYER_TOGGLE" {
+				function = "TG"
+			}
+			tapDance.OnTap, tapDance.OnDoubleTap = args[0], fmt.Sprintf("%s(%s)", function, args[1])
+		}
+
+		byIndex[index] = tapDance
+		count = max(count, index+1)
+		return nil
+	})
+	if err != nil {
+		return tapDances, err
+	}
+
+	for index := range count {
+		tapDance, ok := byIndex[index]
+		if !ok {
+			tapDance = TapDance{OnTap: "KC_NO", OnHold: "KC_NO", OnDoubleTap: "KC_NO", OnTapHold: "KC_NO"}
+		}
+
+		tapDances = append(tapDances, tapDance)
+	}
+
+	return tapDances, nil
+}
+
+// preprocessKeymapC strips comments, joins continued lines and collects the
+// #defines and enums. Newlines are kept so offsets still map to source lines.
+func preprocessKeymapC(src string) keymapSource {
+	source := keymapSource{
+		defines: map[string]string{},
+		enums:   map[string]int{},
+	}
+
+	// the blank key shorthands come from QMK's headers rather than the keymap
+	for alias, name := range keycodeAliases {
+		source.defines[alias] = "KC_" + name
+	}
+
+	text := stripComments(src)
+	text = strings.ReplaceAll(text, "\\\r\n", "  ")
+	text = strings.ReplaceAll(text, "\\\n", " ")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		// function-like macros are left alone, only aliases are expanded
+		match := defineRegex.FindStringSubmatch(line)
+		if match != nil && match[2] == "" {
+			source.defines[match[1]] = strings.TrimSpace(match[3])
+		}
+
+		lines[i] = ""
+	}
+	source.text = strings.Join(lines, "\n")
+
+	for _, match := range enumRegex.FindAllStringSubmatch(source.text, -1) {
+		value := 0
+		known := true
+
+		for _, member := range strings.Split(match[1], ",") {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+
+			name := member
+			if equals := strings.Index(member, "="); equals != -1 {
+				name = strings.TrimSpace(member[:equals])
+				assigned, err := source.evalInt(strings.TrimSpace(member[equals+1:]))
+				value, known = assigned, err == nil
+			}
+
+			// members after something like SAFE_RANGE have no usable value
+			if known {
+				source.enums[name] = value
+			}
+			value += 1
+		}
+	}
+
+	return source
+}
+
+func stripComments(src string) string {
+	builder := strings.Builder{}
+	inString := false
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+
+		if inString {
+			builder.WriteByte(c)
+			if c == '\\' && i+1 < len(src) {
+				i += 1
+				builder.WriteByte(src[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+			builder.WriteByte(c)
+			continue
+		}
+
+		if c == '/' && i+1 < len(src) && src[i+1] == '/' {
+			for i < len(src) && src[i] != '\n' {
+				i += 1
+			}
+			if i < len(src) {
+				builder.WriteByte('\n')
+			}
+			continue
+		}
+
+		if c == '/' && i+1 < len(src) && src[i+1] == '*' {
+			i += 2
+			for i < len(src) && !(src[i] == '*' && i+1 < len(src) && src[i+1] == '/') {
+				if src[i] == '\n' {
+					builder.WriteByte('\n')
+				}
+				i += 1
+			}
+			i += 1
+			builder.WriteByte(' ')
+			continue
+		}
+
+		builder.WriteByte(c)
+	}
+
+	return builder.String()
+}
+
+// matchingBrace returns the index of the brace closing the one at open.
+func matchingBrace(text string, open int, what string) (int, error) {
+	depth := 0
+	for i := open; i < len(text); i++ {
+		switch text[i] {
+		case '{':
+			depth += 1
+		case '}':
+			depth -= 1
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+
+	return -1, fmt.Errorf("line %d: unbalanced braces in %s", strings.Count(text[:open], "\n")+1, what)
+}
+
+// splitTopLevel splits on commas that aren't nested in parentheses or braces.
+func splitTopLevel(text string) []string {
+	parts := []string{}
+	depth := 0
+	start := 0
+
+	for i, c := range text {
+		switch c {
+		case '(', '{', '[':
+			depth += 1
+		case ')', '}', ']':
+			depth -= 1
+		case ',':
+			if depth == 0 {
+				parts = append(parts, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, text[start:])
+}
+
+// line returns the source line of entry, searching from offset.
+func (s keymapSource) line(offset int, entry string) int {
+	index := strings.Index(s.text[offset:], entry)
+	if index == -1 {
+		index = 0
+	}
+
+	return strings.Count(s.text[:offset+index], "\n") + 1
+}
+
+// expand replaces #define aliases and enum constants in a keycode expression.
+func (s keymapSource) expand(expr string, depth int) string {
+	tokens, err := Lex(expr)
+	if err != nil || depth > maxDefineDepth {
+		return strings.Join(strings.Fields(expr), "")
+	}
+
+	builder := strings.Builder{}
+	for _, token := range tokens {
+		text := token.Text
+
+		if token.Kind == TokenIdent {
+			if value, ok := s.defines[text]; ok {
+				text = s.expand(value, depth+1)
+			} else if value, ok := s.enums[text]; ok {
+				text = strconv.Itoa(value)
+			}
+		}
+
+		builder.WriteString(text)
+	}
+
+	return builder.String()
+}
+
+// evalInt resolves a layer index written as a number, enum constant or
+// #define.
+func (s keymapSource) evalInt(expr string) (int, error) {
+	expanded := strings.Trim(s.expand(expr, 0), "()")
+
+	value, err := strconv.ParseInt(expanded, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not resolve '%s' to a number", expr)
+	}
+
+	return int(value), nil
+}
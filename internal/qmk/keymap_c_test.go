@@ -0,0 +1,108 @@
+package qmk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoadKeymapFromC(t *testing.T) {
+	keymap := KeymapData{}
+	err := LoadKeymapFromC("./test_content/keymap_c/ferris_sweep_test/keymap.c", &keymap)
+	NoError(t, err)
+
+	expected := KeymapData{}
+	err = LoadKeymapFromJSON("./test_content/keymaps/LAYOUT_split_3x5_2/ferris_sweep_test.json", &expected)
+	NoError(t, err)
+
+	Equal(t, "ferris_sweep_test", keymap.Keymap)
+	Equal(t, "LAYOUT_split_3x5_2", keymap.Layout)
+	Equal(t, len(expected.Layers), len(keymap.Layers))
+
+	for i := range expected.Layers {
+		ArrayEqual(t, expected.Layers[i], keymap.Layers[i])
+	}
+
+	layers, err := keymap.ParseLayers()
+	NoError(t, err)
+	Equal(t, "LT 1", layers[0][32].Hold)
+}
+
+func TestParseKeymapCDesignators(t *testing.T) {
+	src := `
+#define LOWER 2
+enum { BASE = 0, UPPER };
+const uint16_t keymaps[][MATRIX_ROWS][MATRIX_COLS] = {
+	[LOWER] = LAYOUT(KC_A, MO(UPPER)),
+	[BASE] = LAYOUT(KC_B, MT(MOD_LCTL | MOD_LSFT, KC_C)),
+};`
+
+	keymap := KeymapData{}
+	NoError(t, ParseKeymapC(src, "test", &keymap))
+
+	Equal(t, "LAYOUT", keymap.Layout)
+	Equal(t, 3, len(keymap.Layers))
+	ArrayEqual(t, []string{"KC_B", "MT(MOD_LCTL|MOD_LSFT,KC_C)"}, keymap.Layers[0])
+	ArrayEqual(t, []string{"KC_NO", "KC_NO"}, keymap.Layers[1])
+	ArrayEqual(t, []string{"KC_A", "MO(1)"}, keymap.Layers[2])
+}
+
+func TestParseKeymapCErrors(t *testing.T) {
+	keymap := KeymapData{}
+
+	err := ParseKeymapC("int main() {}", "test", &keymap)
+	ErrorEqual(t, errors.New("could not find keymaps array"), err)
+
+	err = ParseKeymapC("const uint16_t keymaps[][2][2] = {\n\t[NOPE] = LAYOUT(KC_A),\n};", "test", &keymap)
+	ErrorEqual(t, errors.New("line 2: could not resolve 'NOPE' to a number"), err)
+
+	err = ParseKeymapC("const uint16_t keymaps[][2][2] = {\n\t[0] = LAYOUT(KC_A),\n", "test", &keymap)
+	ErrorEqual(t, errors.New("line 1: unbalanced braces in keymaps array"), err)
+}
+
+func TestParseKeymapCCombosAndTapDances(t *testing.T) {
+	src := `
+enum { TD_ESC_CAPS, TD_FN, TD_NAV };
+enum combos { JK_ESC, DF_TAB };
+#define HOME_J RSFT_T(KC_J)
+
+const uint16_t keymaps[][MATRIX_ROWS][MATRIX_COLS] = {
+	[0] = LAYOUT(HOME_J, KC_K, KC_D, KC_F, TD(TD_ESC_CAPS), TD(TD_NAV)),
+};
+
+const uint16_t PROGMEM jk_combo[] = {HOME_J, KC_K, COMBO_END};
+const uint16_t PROGMEM df_combo[] = {KC_D, KC_F, COMBO_END};
+combo_t key_combos[] = {
+	[DF_TAB] = COMBO(df_combo, KC_TAB),
+	[JK_ESC] = COMBO(jk_combo, KC_ESC),
+	COMBO_ACTION(df_combo),
+};
+
+tap_dance_action_t tap_dance_actions[] = {
+	[TD_ESC_CAPS] = ACTION_TAP_DANCE_DOUBLE(KC_ESC, KC_CAPS),
+	[TD_NAV] = ACTION_TAP_DANCE_LAYER_MOVE(KC_B, 1),
+	[TD_FN] = ACTION_TAP_DANCE_FN(dance_fn),
+};`
+
+	keymap := KeymapData{}
+	NoError(t, ParseKeymapC(src, "test", &keymap))
+
+	ArrayEqual(t, []string{"RSFT_T(KC_J)", "KC_K", "KC_D", "KC_F", "TD(0)", "TD(2)"}, keymap.Layers[0])
+
+	Equal(t, 2, len(keymap.Combos))
+	ArrayEqual(t, []string{"KC_D", "KC_F"}, keymap.Combos[0].Keys)
+	Equal(t, "KC_TAB", keymap.Combos[0].Output)
+	ArrayEqual(t, []string{"RSFT_T(KC_J)", "KC_K"}, keymap.Combos[1].Keys)
+	Equal(t, "KC_ESC", keymap.Combos[1].Output)
+
+	Equal(t, 3, len(keymap.TapDances))
+	Equal(t, TapDance{OnTap: "KC_ESC", OnHold: "KC_NO", OnDoubleTap: "KC_CAPS", OnTapHold: "KC_NO"}, keymap.TapDances[0])
+	Equal(t, "KC_NO", keymap.TapDances[1].Keycode())
+	Equal(t, TapDance{OnTap: "KC_B", OnHold: "KC_NO", OnDoubleTap: "TO(1)", OnTapHold: "KC_NO"}, keymap.TapDances[2])
+
+	layers, err := keymap.ParseLayers()
+	NoError(t, err)
+	Equal(t, "esc", layers[0][4].Output())
+
+	err = ParseKeymapC("const uint16_t keymaps[][2][2] = {\n\t[0] = LAYOUT(KC_A),\n};\ncombo_t key_combos[] = {\n\tCOMBO(ab_combo, KC_C),\n};", "test", &keymap)
+	ErrorEqual(t, errors.New("line 5: could not find combo keys 'ab_combo'"), err)
+}
@@ -0,0 +1,178 @@
+package qmk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// kleMatrixRegex matches the "row,col" legends VIA puts on KLE layouts.
+var kleMatrixRegex = regexp.MustCompile(`^(\d+),(\d+)$`)
+
+// kleProps are the key properties of a KLE row object the analyzer uses,
+// everything else only changes how a key looks.
+type kleProps struct {
+	X  *float64 `json:"x"`
+	Y  *float64 `json:"y"`
+	W  *float64 `json:"w"`
+	H  *float64 `json:"h"`
+	R  *float64 `json:"r"`
+	RX *float64 `json:"rx"`
+	RY *float64 `json:"ry"`
+	D  bool     `json:"d"`
+}
+
+type kleMetadata struct {
+	Name string `json:"name"`
+}
+
+// IsKLE reports whether b looks like keyboard-layout-editor.com raw data,
+// which is a JSON array rather than an info.json object. Comments before the
+// data are skipped.
+func IsKLE(b []byte) bool {
+	trimmed := bytes.TrimSpace(b)
+	for len(trimmed) > 0 {
+		switch {
+		case trimmed[0] == '#', bytes.HasPrefix(trimmed, []byte("//")):
+			end := bytes.IndexByte(trimmed, '\n')
+			if end < 0 {
+				return false
+			}
+			trimmed = bytes.TrimSpace(trimmed[end:])
+		case bytes.HasPrefix(trimmed, []byte("/*")):
+			end := bytes.Index(trimmed, []byte("*/"))
+			if end < 0 {
+				return false
+			}
+			trimmed = bytes.TrimSpace(trimmed[end+2:])
+		default:
+			return trimmed[0] == '['
+		}
+	}
+
+	return false
+}
+
+// ParseLayoutJSON reads a layout from either a QMK info.json or KLE raw data,
+// see ParseKLE. Both may be written as HJSON, see DecodeConfig.
+func ParseLayoutJSON(b []byte, name string, layoutData *LayoutData) error {
+	if IsKLE(b) {
+		return ParseKLE(b, name, layoutData)
+	}
+
+	return DecodeConfig(b, layoutData)
+}
+
+// ParseKLE converts keyboard-layout-editor.com raw data into a layout named
+// name. Keys are positioned the way KLE draws them, including rotated
+// clusters, and legends of the form "row,col" become matrix positions.
+func ParseKLE(b []byte, name string, layoutData *LayoutData) error {
+	rows := []json.RawMessage{}
+	err := DecodeConfig(b, &rows)
+	if err != nil {
+		return err
+	}
+
+	layout := Layout{}
+	keyboardName := name
+
+	x, y := 0.0, 0.0
+	w, h := 1.0, 1.0
+	r, rx, ry := 0.0, 0.0, 0.0
+	decal := false
+
+	for rowIndex, rawRow := range rows {
+		// the first entry may be an object holding the keyboard metadata
+		if rowIndex == 0 && bytes.HasPrefix(bytes.TrimSpace(rawRow), []byte("{")) {
+			metadata := kleMetadata{}
+			err := json.Unmarshal(rawRow, &metadata)
+			if err != nil {
+				return fmt.Errorf("metadata: %w", err)
+			}
+			if metadata.Name != "" {
+				keyboardName = metadata.Name
+			}
+			continue
+		}
+
+		row := []json.RawMessage{}
+		err := json.Unmarshal(rawRow, &row)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", rowIndex, err)
+		}
+
+		for itemIndex, item := range row {
+			legend := ""
+			if json.Unmarshal(item, &legend) != nil {
+				props := kleProps{}
+				err := json.Unmarshal(item, &props)
+				if err != nil {
+					return fmt.Errorf("row %d, item %d: %w", rowIndex, itemIndex, err)
+				}
+
+				if props.R != nil {
+					r = *props.R
+				}
+				// a new rotation origin restarts positions from it
+				if props.RX != nil {
+					rx = *props.RX
+					x, y = rx, ry
+				}
+				if props.RY != nil {
+					ry = *props.RY
+					x, y = rx, ry
+				}
+				if props.X != nil {
+					x += *props.X
+				}
+				if props.Y != nil {
+					y += *props.Y
+				}
+				if props.W != nil {
+					w = *props.W
+				}
+				if props.H != nil {
+					h = *props.H
+				}
+				decal = decal || props.D
+
+				continue
+			}
+
+			// decals are labels drawn on the board, not keys
+			if !decal {
+				key := KeyPosition{X: x, Y: y, W: w, H: h, R: r, RX: rx, RY: ry}
+
+				match := kleMatrixRegex.FindStringSubmatch(strings.Split(legend, "\n")[0])
+				if match != nil {
+					row, _ := strconv.Atoi(match[1])
+					col, _ := strconv.Atoi(match[2])
+					key.Matrix = []int{row, col}
+				}
+
+				layout = append(layout, key)
+			}
+
+			x += w
+			w, h = 1.0, 1.0
+			decal = false
+		}
+
+		y += 1
+		x = rx
+	}
+
+	if len(layout) == 0 {
+		return fmt.Errorf("kle layout has no keys")
+	}
+
+	layoutData.KeyboardName = keyboardName
+	layoutData.Layout = map[string]map[string]Layout{
+		name: {"layout": layout},
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package qmk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseKLE(t *testing.T) {
+	layoutData := LayoutData{}
+	err := LoadLayoutFromJSON("./test_content/kle/LAYOUT_tiny_split.json", &layoutData)
+	NoError(t, err)
+
+	Equal(t, "tiny split", layoutData.KeyboardName)
+
+	layout := layoutData.Layout["LAYOUT_tiny_split"]["layout"]
+	Equal(t, 9, len(layout))
+
+	expected := []KeyPosition{
+		{X: 0, Y: 0, W: 1, H: 1},
+		{X: 1, Y: 0, W: 1, H: 1},
+		{X: 3, Y: 0, W: 1, H: 1},
+		{X: 4, Y: 0, W: 1, H: 1},
+		// the decal before it takes up space but isn't a key
+		{X: 1, Y: 1, W: 1, H: 1},
+		{X: 2, Y: 1, W: 1.5, H: 1},
+		// rotated rows start from the rotation origin
+		{X: 1, Y: 2.5, W: 1, H: 1, R: 15, RX: 1, RY: 3},
+		{X: 2, Y: 2.5, W: 1, H: 2, R: 15, RX: 1, RY: 3},
+		{X: 1, Y: 3.5, W: 1, H: 1, R: 15, RX: 1, RY: 3},
+	}
+
+	matrix := [][]int{{0, 0}, {0, 1}, {0, 2}, {0, 3}, {1, 0}, {1, 1}, {2, 0}, {2, 1}, {3, 0}}
+
+	for i, key := range layout {
+		ArrayEqual(t, matrix[i], key.Matrix)
+		Equal(t, expected[i].X, key.X)
+		Equal(t, expected[i].Y, key.Y)
+		Equal(t, expected[i].W, key.W)
+		Equal(t, expected[i].H, key.H)
+		Equal(t, expected[i].R, key.R)
+		Equal(t, expected[i].RX, key.RX)
+		Equal(t, expected[i].RY, key.RY)
+	}
+}
+
+func TestParseLayoutJSON(t *testing.T) {
+	Equal(t, true, IsKLE([]byte("  [[\"Esc\"]]")))
+	Equal(t, false, IsKLE([]byte(`{"layouts": {}}`)))
+
+	layoutData := LayoutData{}
+	err := ParseLayoutJSON([]byte(`[["Q", "W"], [{"x": 0.25}, "A"]]`), "LAYOUT_kle", &layoutData)
+	NoError(t, err)
+	Equal(t, "LAYOUT_kle", layoutData.KeyboardName)
+
+	layout := layoutData.Layout["LAYOUT_kle"]["layout"]
+	Equal(t, 3, len(layout))
+	Equal(t, 0.25, layout[2].X)
+	Equal(t, 1.0, layout[2].Y)
+	Equal(t, 0, len(layout[2].Matrix))
+
+	err = ParseLayoutJSON([]byte(`{"keyboard_name": "info", "layouts": {"LAYOUT": {"layout": [{"x": 0, "y": 0}]}}}`), "LAYOUT", &layoutData)
+	NoError(t, err)
+	Equal(t, "info", layoutData.KeyboardName)
+
+	err = ParseLayoutJSON([]byte(`[{"name": "empty"}]`), "LAYOUT_kle", &layoutData)
+	ErrorEqual(t, errors.New("kle layout has no keys"), err)
+}
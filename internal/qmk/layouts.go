@@ -1,48 +1,261 @@
 package qmk
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
 type LayoutData struct {
-	KeyboardName string                       `json:"keyboard_name"`
-	URL          string                       `json:"url"`
-	Maintainer   string                       `json:"maintainer"`
-	Layout       map[string]map[string]Layout `json:"layouts"`
+	KeyboardName  string                       `json:"keyboard_name"`
+	URL           string                       `json:"url"`
+	Maintainer    string                       `json:"maintainer"`
+	Layout        map[string]map[string]Layout `json:"layouts"`
+	LayoutAliases map[string]string            `json:"layout_aliases,omitempty"`
+	// KeyPitch is how far apart the keys of the keyboard are, for boards not
+	// spaced like MX switches.
+	KeyPitch *KeyPitch `json:"key_pitch,omitempty"`
 }
 
 type Layout []KeyPosition
 
+// KeyPitch is the distance between the centers of neighbouring keys in
+// millimeters, across and down. Left out or zero, they are those of MX
+// switches.
+type KeyPitch struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// DefaultKeyPitch is the spacing of MX switches, which keyboard units are
+// based on.
+var DefaultKeyPitch = KeyPitch{X: 19.05, Y: 19.05}
+
+// Millimeters converts a distance in keyboard units into millimeters.
+func (p KeyPitch) Millimeters(dx, dy float64) (float64, float64) {
+	x, y := p.X, p.Y
+	if x <= 0 {
+		x = DefaultKeyPitch.X
+	}
+	if y <= 0 {
+		y = DefaultKeyPitch.Y
+	}
+
+	return dx * x, dy * y
+}
+
+// Pitch returns the key spacing of the keyboard.
+func (ld *LayoutData) Pitch() KeyPitch {
+	if ld.KeyPitch == nil {
+		return DefaultKeyPitch
+	}
+
+	return *ld.KeyPitch
+}
+
+// KeyPosition is a key in keyboard units. R rotates the key by R degrees
+// clockwise around (RX, RY), the same as in QMK info.json and KLE.
 type KeyPosition struct {
 	X      float64 `json:"x"`
 	Y      float64 `json:"y"`
 	W      float64 `json:"w"`
 	H      float64 `json:"h"`
+	R      float64 `json:"r,omitempty"`
+	RX     float64 `json:"rx,omitempty"`
+	RY     float64 `json:"ry,omitempty"`
 	Matrix []int   `json:"matrix"`
 }
 
-func (q *QMKHelper) GetAllLayouts() ([]string, error) {
-	layouts := []string{}
-	files, err := os.ReadDir(q.LayoutDir)
-	if err != nil {
-		return layouts, err
+// Size returns the key's width and height, info.json leaves out the default
+// of 1.
+func (p KeyPosition) Size() (float64, float64) {
+	w, h := p.W, p.H
+	if w == 0 {
+		w = 1
+	}
+	if h == 0 {
+		h = 1
+	}
+
+	return w, h
+}
+
+// Rotate returns where the unrotated point (x, y) ends up once the key's
+// rotation is applied.
+func (p KeyPosition) Rotate(x, y float64) (float64, float64) {
+	if p.R == 0 {
+		return x, y
+	}
+
+	sin, cos := math.Sincos(p.R * math.Pi / 180)
+	dx, dy := x-p.RX, y-p.RY
+
+	return p.RX + dx*cos - dy*sin, p.RY + dx*sin + dy*cos
+}
+
+// Center returns the middle of the key after rotation, which is where travel
+// to and from the key is measured.
+func (p KeyPosition) Center() (float64, float64) {
+	w, h := p.Size()
+	return p.Rotate(p.X+w/2, p.Y+h/2)
+}
+
+// Corners returns the four corners of the key after rotation, clockwise from
+// the top left.
+func (p KeyPosition) Corners() [4][2]float64 {
+	w, h := p.Size()
+	corners := [4][2]float64{{p.X, p.Y}, {p.X + w, p.Y}, {p.X + w, p.Y + h}, {p.X, p.Y + h}}
+	for i, corner := range corners {
+		corners[i][0], corners[i][1] = p.Rotate(corner[0], corner[1])
 	}
 
-	for _, f := range files {
-		if !f.IsDir() && path.Ext(f.Name()) == ".json" {
-			layouts = append(layouts, strings.Split(path.Base(f.Name()), ".")[0])
+	return corners
+}
+
+// layoutEntry records which file defines a layout and under what name, so
+// aliases load the layout they point to.
+type layoutEntry struct {
+	File   string
+	Layout string
+	Pitch  KeyPitch
+}
+
+// maxAliasDepth bounds alias chains so aliases pointing at each other can't loop.
+const maxAliasDepth = 8
+
+// Resolve returns the named layout, following layout_aliases if name is not
+// one of the file's own variants.
+func (ld *LayoutData) Resolve(name string) (Layout, bool) {
+	for range maxAliasDepth {
+		if variant, ok := ld.Layout[name]; ok {
+			return variant["layout"], true
+		}
+
+		target, ok := ld.LayoutAliases[name]
+		if !ok {
+			return nil, false
+		}
+		name = target
+	}
+
+	return nil, false
+}
+
+// Names lists every layout variant and alias defined by the file.
+func (ld *LayoutData) Names() []string {
+	names := []string{}
+	for name := range ld.Layout {
+		names = append(names, name)
+	}
+	for alias := range ld.LayoutAliases {
+		if _, ok := ld.Resolve(alias); ok {
+			names = append(names, alias)
 		}
 	}
+	sort.Strings(names)
+
+	return names
+}
+
+// IndexLayouts scans the layout directory, including subdirectories such as
+// a copy of qmk_firmware/layouts/default, and registers every variant and
+// alias of each info.json, keyboard.json or KLE file found. Files that can't
+// be read are skipped with a warning.
+func (q *QMKHelper) IndexLayouts() error {
+	q.LayoutLock.Lock()
+	defer q.LayoutLock.Unlock()
+
+	q.layoutIndex = map[string]layoutEntry{}
+
+	return filepath.WalkDir(q.LayoutDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || path.Ext(file) != ".json" {
+			return nil
+		}
+
+		layoutData := LayoutData{}
+		err = LoadLayoutFromJSON(file, &layoutData)
+		if err != nil {
+			fmt.Printf("WARN: could not index layout file %s: %s\n", file, err.Error())
+			return nil
+		}
+
+		q.registerLayouts(file, layoutData)
+		return nil
+	})
+}
+
+// registerLayouts adds the layouts of file to the index. The first file to
+// define a name keeps it.
+func (q *QMKHelper) registerLayouts(file string, layoutData LayoutData) {
+	if q.layoutIndex == nil {
+		q.layoutIndex = map[string]layoutEntry{}
+	}
+
+	for _, name := range layoutData.Names() {
+		if existing, ok := q.layoutIndex[name]; ok {
+			if existing.File != file {
+				fmt.Printf("WARN: layout %s in %s is already defined by %s, ignoring\n", name, file, existing.File)
+			}
+			continue
+		}
+
+		q.layoutIndex[name] = layoutEntry{File: file, Layout: name, Pitch: layoutData.Pitch()}
+	}
+}
+
+// findLayout looks a layout up in the index. Files copied into the layout
+// directory after it was indexed are found by name, as <layout>.json, and
+// registered then. The caller holds LayoutLock.
+func (q *QMKHelper) findLayout(layout string) (layoutEntry, bool) {
+	if entry, ok := q.layoutIndex[layout]; ok {
+		return entry, true
+	}
+
+	filePath := path.Join(q.LayoutDir, layout+".json")
+	if _, err := os.Stat(filePath); err != nil {
+		return layoutEntry{}, false
+	}
+
+	layoutData := LayoutData{}
+	err := LoadLayoutFromJSON(filePath, &layoutData)
+	if err != nil {
+		fmt.Printf("WARN: could not index layout file %s: %s\n", filePath, err.Error())
+		return layoutEntry{}, false
+	}
+
+	q.registerLayouts(filePath, layoutData)
+
+	entry, ok := q.layoutIndex[layout]
+	return entry, ok
+}
+
+// GetAllLayouts lists every indexed layout variant and alias.
+func (q *QMKHelper) GetAllLayouts() ([]string, error) {
+	q.LayoutLock.Lock()
+	defer q.LayoutLock.Unlock()
+
+	layouts := []string{}
+	for name := range q.layoutIndex {
+		layouts = append(layouts, name)
+	}
+	sort.Strings(layouts)
 
 	return layouts, nil
 }
 
+// SaveLayout stores an uploaded layout file and indexes all of its variants
+// and aliases, not only the one named.
 func (q *QMKHelper) SaveLayout(name string, data []byte) (string, error) {
 	filePath := path.Join(q.LayoutDir, fmt.Sprintf("%s.json", name))
 
@@ -51,6 +264,12 @@ func (q *QMKHelper) SaveLayout(name string, data []byte) (string, error) {
 		return "", errors.New(fmt.Sprintf("%s already exists", filePath))
 	}
 
+	layoutData := LayoutData{}
+	err = ParseLayoutJSON(data, name, &layoutData)
+	if err != nil {
+		return "", err
+	}
+
 	f, err := os.Create(filePath)
 	defer f.Close()
 	if err != nil {
@@ -62,6 +281,10 @@ func (q *QMKHelper) SaveLayout(name string, data []byte) (string, error) {
 		return "", err
 	}
 
+	q.LayoutLock.Lock()
+	q.registerLayouts(filePath, layoutData)
+	q.LayoutLock.Unlock()
+
 	return filePath, nil
 }
 
@@ -79,14 +302,25 @@ func LoadLayoutFromJSON(jsonPath string, layoutData *LayoutData) error {
 		return err
 	}
 
-	err = json.Unmarshal(b, layoutData)
+	err = ParseLayoutJSON(b, kleLayoutName(jsonPath), layoutData)
 	if err != nil {
-		return err
+		return fmt.Errorf("%s: %w", jsonPath, err)
 	}
 
 	return nil
 }
 
+// kleLayoutName names the layout of a KLE file, which has no name of its own,
+// after the file. qmk_firmware community layouts are all called layout.json,
+// so those are named after their directory like QMK does.
+func kleLayoutName(jsonPath string) string {
+	if path.Base(jsonPath) == "layout.json" {
+		return "LAYOUT_" + path.Base(path.Dir(jsonPath))
+	}
+
+	return strings.TrimSuffix(path.Base(jsonPath), path.Ext(jsonPath))
+}
+
 func (q *QMKHelper) GetLayoutData(layout string) (Layout, error) {
 	q.LayoutLock.Lock()
 	defer q.LayoutLock.Unlock()
@@ -95,12 +329,21 @@ func (q *QMKHelper) GetLayoutData(layout string) (Layout, error) {
 
 	data, ok := q.LayoutCache.Get(layout)
 	if !ok {
+		entry, ok := q.findLayout(layout)
+		if !ok {
+			return cachedLayout, fmt.Errorf("layout %s not found in %s", layout, q.LayoutDir)
+		}
+
 		layoutData := LayoutData{}
-		err := LoadLayoutFromJSON(fmt.Sprintf("%s/%s.json", q.LayoutDir, layout), &layoutData)
+		err := LoadLayoutFromJSON(entry.File, &layoutData)
 		if err != nil {
 			return cachedLayout, err
 		}
-		cachedLayout = layoutData.Layout[layout]["layout"]
+
+		cachedLayout, ok = layoutData.Resolve(entry.Layout)
+		if !ok {
+			return cachedLayout, fmt.Errorf("layout %s no longer in %s", layout, entry.File)
+		}
 	} else {
 		cachedLayout, ok = data.(Layout)
 		if !ok {
@@ -112,3 +355,17 @@ func (q *QMKHelper) GetLayoutData(layout string) (Layout, error) {
 
 	return cachedLayout, nil
 }
+
+// GetLayoutPitch returns the key spacing of the keyboard a layout file
+// describes, that of MX switches for layouts it doesn't know.
+func (q *QMKHelper) GetLayoutPitch(layout string) KeyPitch {
+	q.LayoutLock.Lock()
+	defer q.LayoutLock.Unlock()
+
+	entry, ok := q.findLayout(layout)
+	if !ok {
+		return DefaultKeyPitch
+	}
+
+	return entry.Pitch
+}
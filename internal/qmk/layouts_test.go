@@ -0,0 +1,187 @@
+package qmk
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path"
+	"testing"
+)
+
+func round(val float64) float64 {
+	return math.Round(val*1000) / 1000
+}
+
+func TestKeyPositionRotation(t *testing.T) {
+	key := KeyPosition{X: 1, Y: 2.5, W: 1, H: 1, R: 90, RX: 1, RY: 3}
+
+	x, y := key.Center()
+	Equal(t, 1.0, round(x))
+	Equal(t, 3.5, round(y))
+
+	corners := key.Corners()
+	Equal(t, 1.5, round(corners[0][0]))
+	Equal(t, 3.0, round(corners[0][1]))
+	Equal(t, 0.5, round(corners[2][0]))
+	Equal(t, 4.0, round(corners[2][1]))
+
+	// info.json leaves out the default size
+	x, y = KeyPosition{X: 2, Y: 1}.Center()
+	Equal(t, 2.5, x)
+	Equal(t, 1.5, y)
+}
+
+func TestEuclideanDistanceRotated(t *testing.T) {
+	home := KeyPosition{X: 0, Y: 0, W: 1, H: 1}
+	thumb := KeyPosition{X: 1, Y: 2.5, W: 1, H: 1, R: 90, RX: 1, RY: 3}
+	Equal(t, 3.041, round(EuclideanDistance(home, thumb)))
+
+	// keys in the same rotated cluster keep their distance
+	next := KeyPosition{X: 2, Y: 2.5, W: 1, H: 1, R: 90, RX: 1, RY: 3}
+	Equal(t, 1.0, round(EuclideanDistance(thumb, next)))
+
+	sequencer := Sequencer{Layout: Layout{home, thumb}, LastLocation: [10]int{0}}
+	sequencer.MovementWeights[0] = MovementCost{Inward: 1, Outward: 1}
+	Equal(t, 0.5, round(sequencer.fingerMoveCost(1, 1)))
+}
+
+func TestKeyPitch(t *testing.T) {
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	// aliases share the spacing of their keyboard
+	Equal(t, KeyPitch{X: 18, Y: 17}, q.GetLayoutPitch("LAYOUT_tiny_alias"))
+	Equal(t, DefaultKeyPitch, q.GetLayoutPitch("LAYOUT_split_3x5_2"))
+	Equal(t, DefaultKeyPitch, q.GetLayoutPitch("LAYOUT_missing"))
+
+	// a pitch left out is that of MX switches
+	x, y := KeyPitch{X: 18}.Millimeters(2, 1)
+	Equal(t, 36.0, x)
+	Equal(t, 19.05, y)
+
+	layout, err := q.GetLayoutData("LAYOUT_tiny")
+	NoError(t, err)
+
+	keyboard, err := q.GetKeyboard(&layout, &KeymapData{Layout: "LAYOUT_tiny"}, 0)
+	NoError(t, err)
+	Equal(t, round(q.KeySize*18/19.05), round(keyboard.Keys[1].W))
+	Equal(t, round(q.KeySize*17/19.05), round(keyboard.Keys[1].H))
+	Equal(t, round(q.KeySize*18/19.05+5), round(keyboard.Keys[1].X))
+
+	// t to d and back is a row down and up
+	sequencer := GetSequencer(t)
+	sequencer.Pitch = KeyPitch{X: 18, Y: 17}
+	sequencer.Build("tdt")
+	travel, _ := sequencer.Analyze(false).Table("travel", "By Finger")
+	Equal(t, 34.0, travel.Fingers[3])
+}
+
+func TestGetKeyboardRotated(t *testing.T) {
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	layoutData := LayoutData{}
+	err = LoadLayoutFromJSON("./test_content/kle/LAYOUT_tiny_split.json", &layoutData)
+	NoError(t, err)
+
+	layout := layoutData.Layout["LAYOUT_tiny_split"]["layout"]
+	keyboard, err := q.GetKeyboard(&layout, &KeymapData{}, 0)
+	NoError(t, err)
+
+	Equal(t, 0.0, keyboard.Keys[0].R)
+	Equal(t, 15.0, keyboard.Keys[6].R)
+	Equal(t, 0.0, keyboard.Keys[6].OriginX)
+	Equal(t, 0.5*q.KeySize, keyboard.Keys[6].OriginY)
+	Equal(t, -q.KeySize, keyboard.Keys[7].OriginX)
+}
+
+func TestLayoutRegistry(t *testing.T) {
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	layouts, err := q.GetAllLayouts()
+	NoError(t, err)
+	ArrayEqual(t, []string{"LAYOUT_split_3x5_2", "LAYOUT_tiny", "LAYOUT_tiny_alias", "LAYOUT_tiny_chain", "LAYOUT_tiny_wide"}, layouts)
+
+	layout, err := q.GetLayoutData("LAYOUT_tiny_wide")
+	NoError(t, err)
+	Equal(t, 3, len(layout))
+
+	// aliases resolve to the layout they point to, through other aliases too
+	layout, err = q.GetLayoutData("LAYOUT_tiny_chain")
+	NoError(t, err)
+	Equal(t, 2, len(layout))
+
+	_, err = q.GetLayoutData("LAYOUT_tiny_missing")
+	ErrorEqual(t, errors.New("layout LAYOUT_tiny_missing not found in test_content/layouts/"), err)
+}
+
+func TestSaveLayoutRegistersVariants(t *testing.T) {
+	q, err := NewQMKHelper(t.TempDir(), "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	data := []byte(`{
+		"keyboard_name": "uploaded",
+		"layouts": {
+			"LAYOUT_one": {"layout": [{"x": 0, "y": 0}]},
+			"LAYOUT_two": {"layout": [{"x": 0, "y": 0}, {"x": 1, "y": 0}]}
+		},
+		"layout_aliases": {"LAYOUT_uploaded": "LAYOUT_two"}
+	}`)
+
+	_, err = q.SaveLayout("LAYOUT_one", data)
+	NoError(t, err)
+
+	layout, err := q.GetLayoutData("LAYOUT_uploaded")
+	NoError(t, err)
+	Equal(t, 2, len(layout))
+
+	_, err = q.SaveLayout("LAYOUT_bad", []byte(`{"layouts": `))
+	Equal(t, true, err != nil)
+}
+
+func TestLayoutCopiedAfterIndexing(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewQMKHelper(dir, "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	_, err = q.GetLayoutData("LAYOUT_copied")
+	Equal(t, true, err != nil)
+
+	// a file copied in by hand is found by its name, with its other variants
+	data := []byte(`{"key_pitch": {"x": 18, "y": 17}, "layouts": {
+		"LAYOUT_copied": {"layout": [{"x": 0, "y": 0}, {"x": 1, "y": 0}]},
+		"LAYOUT_other": {"layout": [{"x": 0, "y": 0}]}
+	}}`)
+	NoError(t, os.WriteFile(path.Join(dir, "LAYOUT_copied.json"), data, 0644))
+
+	layout, err := q.GetLayoutData("LAYOUT_copied")
+	NoError(t, err)
+	Equal(t, 2, len(layout))
+	Equal(t, KeyPitch{X: 18, Y: 17}, q.GetLayoutPitch("LAYOUT_copied"))
+
+	layouts, err := q.GetAllLayouts()
+	NoError(t, err)
+	ArrayEqual(t, []string{"LAYOUT_copied", "LAYOUT_other"}, layouts)
+}
+
+func TestLayoutDataResolve(t *testing.T) {
+	layoutData := LayoutData{
+		Layout: map[string]map[string]Layout{
+			"LAYOUT_a": {"layout": Layout{{X: 0, Y: 0}}},
+		},
+		LayoutAliases: map[string]string{
+			"LAYOUT":      "LAYOUT_a",
+			"LAYOUT_loop": "LAYOUT_pool",
+			"LAYOUT_pool": "LAYOUT_loop",
+		},
+	}
+
+	_, ok := layoutData.Resolve("LAYOUT")
+	Equal(t, true, ok)
+
+	_, ok = layoutData.Resolve("LAYOUT_loop")
+	Equal(t, false, ok)
+
+	ArrayEqual(t, []string{"LAYOUT", "LAYOUT_a"}, layoutData.Names())
+}
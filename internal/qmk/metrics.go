@@ -0,0 +1,192 @@
+package qmk
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metric collects one statistic over a built sequence. Analyze hands every
+// event of the sequence to Observe in order, then Finalize turns what was
+// seen into a result.
+type Metric interface {
+	Observe(event SequenceEvent)
+	Finalize() MetricResult
+}
+
+// MetricInfo registers a metric. New is called for every analysis, so a
+// metric can keep its state in itself.
+type MetricInfo struct {
+	Name  string
+	Title string
+	// Values names the values the metric reports, which scoring profiles
+	// weigh. Names are shared by all metrics, so each must be unique.
+	Values []string
+	New    func(s *Sequencer, includeRepeated bool) Metric
+}
+
+// MetricResult is what a metric found: named values and tables breaking them
+// down, rendered in the order given.
+type MetricResult struct {
+	Name   string
+	Title  string
+	Values []MetricValue
+	Tables []MetricTable
+}
+
+type MetricValue struct {
+	Name  string
+	Label string
+	Value float64
+	Unit  string
+}
+
+// MetricTable breaks a value down, either by label in Entries or by finger
+// in fingermap order in Fingers.
+type MetricTable struct {
+	Title   string
+	Entries []CountEntry
+	Fingers []float64
+	Unit    string
+}
+
+var (
+	metricRegistry     = []MetricInfo{}
+	metricRegistryLock sync.Mutex
+)
+
+// RegisterMetric adds a metric to every analysis from then on, after the
+// metrics registered before it.
+func RegisterMetric(info MetricInfo) error {
+	metricRegistryLock.Lock()
+	defer metricRegistryLock.Unlock()
+
+	if info.Name == "" || info.New == nil {
+		return fmt.Errorf("metric needs a name and a constructor")
+	}
+
+	for _, registered := range metricRegistry {
+		if registered.Name == info.Name {
+			return fmt.Errorf("metric %s is already registered", info.Name)
+		}
+
+		for _, value := range info.Values {
+			if slices.Contains(registered.Values, value) {
+				return fmt.Errorf("metric %s: value %s is already reported by metric %s", info.Name, value, registered.Name)
+			}
+		}
+	}
+
+	metricRegistry = append(metricRegistry, info)
+
+	return nil
+}
+
+// UnregisterMetric removes a metric, mostly so experiments can be undone.
+func UnregisterMetric(name string) {
+	metricRegistryLock.Lock()
+	defer metricRegistryLock.Unlock()
+
+	for i, registered := range metricRegistry {
+		if registered.Name == name {
+			metricRegistry = append(metricRegistry[:i:i], metricRegistry[i+1:]...)
+			return
+		}
+	}
+}
+
+// RegisteredMetrics lists the metrics every analysis runs, in order.
+func RegisteredMetrics() []MetricInfo {
+	metricRegistryLock.Lock()
+	defer metricRegistryLock.Unlock()
+
+	return append([]MetricInfo{}, metricRegistry...)
+}
+
+// MetricValueNames lists the values of every registered metric, which is
+// what scoring profiles can weigh.
+func MetricValueNames() []string {
+	names := []string{}
+	for _, info := range RegisteredMetrics() {
+		names = append(names, info.Values...)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func mustRegisterMetric(info MetricInfo) {
+	err := RegisterMetric(info)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Metric returns the result of the named metric.
+func (d AnalysisData) Metric(name string) (MetricResult, bool) {
+	for _, result := range d.Metrics {
+		if result.Name == name {
+			return result, true
+		}
+	}
+
+	return MetricResult{}, false
+}
+
+// Value returns a value by name from whichever metric reported it, 0 when
+// none did.
+func (d AnalysisData) Value(name string) float64 {
+	for _, result := range d.Metrics {
+		for _, value := range result.Values {
+			if value.Name == name {
+				return value.Value
+			}
+		}
+	}
+
+	return 0
+}
+
+// Table returns a metric's breakdown by its title.
+func (d AnalysisData) Table(metric, title string) (MetricTable, bool) {
+	result, ok := d.Metric(metric)
+	if !ok {
+		return MetricTable{}, false
+	}
+
+	for _, table := range result.Tables {
+		if table.Title == title {
+			return table, true
+		}
+	}
+
+	return MetricTable{}, false
+}
+
+// countedEvent reports whether an event is a key going down. Layer changes
+// without a key of their own are counted as switches only.
+func countedEvent(event SequenceEvent) bool {
+	if event.Action == "release" {
+		return false
+	}
+
+	return !strings.Contains(event.Action, "layer") || isKeyDown(event.Action)
+}
+
+// soloPress reports whether an event is a key pressed on its own, keys of a
+// combo go down together.
+func soloPress(event SequenceEvent) bool {
+	return countedEvent(event) && isKeyDown(event.Action) && event.Action != "press-combo"
+}
+
+// fingerTable turns per finger values into a table.
+func fingerTable[T int | float64](title string, values [10]T, unit string) MetricTable {
+	fingers := make([]float64, len(values))
+	for i, value := range values {
+		fingers[i] = float64(value)
+	}
+
+	return MetricTable{Title: title, Fingers: fingers, Unit: unit}
+}
@@ -0,0 +1,414 @@
+package qmk
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+func init() {
+	mustRegisterMetric(MetricInfo{
+		Name:   "fingers",
+		Title:  "Keypresses Per Finger",
+		Values: []string{"key_presses"},
+		New: func(s *Sequencer, includeRepeated bool) Metric {
+			return &fingerMetric{}
+		},
+	})
+	mustRegisterMetric(MetricInfo{
+		Name:   "sfb",
+		Title:  "Same Finger Bigrams",
+		Values: []string{"sfb"},
+		New: func(s *Sequencer, includeRepeated bool) Metric {
+			return &sfbMetric{includeRepeated: includeRepeated, lastFinger: -1, counts: make(map[string]int)}
+		},
+	})
+	mustRegisterMetric(MetricInfo{
+		Name:   "skipgrams",
+		Title:  "Same Finger Skipgrams",
+		Values: []string{"skipgram"},
+		New: func(s *Sequencer, includeRepeated bool) Metric {
+			return newSkipgramMetric(s.SkipgramWeights, includeRepeated)
+		},
+	})
+	mustRegisterMetric(MetricInfo{
+		Name:   "stretches",
+		Title:  "Stretches and Scissors",
+		Values: []string{"lateral_stretch", "scissor", "half_scissor"},
+		New: func(s *Sequencer, includeRepeated bool) Metric {
+			return &stretchMetric{
+				layout:           s.Layout,
+				lateralStretches: make(map[string]int),
+				scissors:         make(map[string]int),
+				halfScissors:     make(map[string]int),
+			}
+		},
+	})
+	mustRegisterMetric(MetricInfo{
+		Name:   "trigrams",
+		Title:  "Trigrams",
+		Values: append([]string{"trigrams"}, trigramValueNames()...),
+		New: func(s *Sequencer, includeRepeated bool) Metric {
+			return &trigramMetric{counts: make(map[TrigramKind]map[string]int)}
+		},
+	})
+	mustRegisterMetric(MetricInfo{
+		Name:   "layers",
+		Title:  "Layers",
+		Values: []string{"layer_switches", "layers_used"},
+		New: func(s *Sequencer, includeRepeated bool) Metric {
+			return &layerMetric{}
+		},
+	})
+	mustRegisterMetric(MetricInfo{
+		Name:   "travel",
+		Title:  "Finger Travel",
+		Values: []string{"travel"},
+		New: func(s *Sequencer, includeRepeated bool) Metric {
+			return &travelMetric{
+				layout:       s.Layout,
+				weights:      s.MovementWeights,
+				pitch:        s.Pitch,
+				home:         s.Home,
+				returnHome:   s.ReturnHome,
+				lastLocation: s.Home,
+			}
+		},
+	})
+	mustRegisterMetric(MetricInfo{
+		Name:   "home",
+		Title:  "Time Off Home",
+		Values: []string{"off_home"},
+		New: func(s *Sequencer, includeRepeated bool) Metric {
+			return &offHomeMetric{home: s.Home, returnHome: s.ReturnHome, locations: s.Home}
+		},
+	})
+	mustRegisterMetric(MetricInfo{
+		Name:   "effort",
+		Title:  "Effort",
+		Values: []string{"effort", "effort_base", "effort_penalty", "effort_stroke"},
+		New: func(s *Sequencer, includeRepeated bool) Metric {
+			return newEffortMetric(s.EffortModel, s.Layout)
+		},
+	})
+}
+
+type fingerMetric struct {
+	counts [10]int
+	total  int
+}
+
+func (m *fingerMetric) Observe(event SequenceEvent) {
+	if !countedEvent(event) || !isKeyDown(event.Action) {
+		return
+	}
+
+	m.counts[event.Finger-1] += 1
+	m.total += 1
+}
+
+func (m *fingerMetric) Finalize() MetricResult {
+	return MetricResult{
+		Values: []MetricValue{{Name: "key_presses", Label: "Key Presses", Value: float64(m.total)}},
+		Tables: []MetricTable{fingerTable("By Finger", m.counts, "")},
+	}
+}
+
+type sfbMetric struct {
+	includeRepeated bool
+	lastFinger      int
+	lastVal         string
+	counts          map[string]int
+	fingers         [10]int
+	total           int
+}
+
+func (m *sfbMetric) Observe(event SequenceEvent) {
+	if !countedEvent(event) {
+		return
+	}
+
+	if m.lastFinger == event.Finger && (m.lastVal != event.Val || m.includeRepeated) {
+		m.counts[pressLabel(m.lastVal, event.Val)] += 1
+		m.total += 1
+		m.fingers[event.Finger-1] += 1
+	}
+
+	m.lastFinger = event.Finger
+	m.lastVal = event.Val
+}
+
+func (m *sfbMetric) Finalize() MetricResult {
+	return MetricResult{
+		Values: []MetricValue{{Name: "sfb", Label: "Same Finger Bigrams", Value: float64(m.total)}},
+		Tables: []MetricTable{
+			{Title: "By Bigram", Entries: countEntries(m.counts)},
+			fingerTable("By Finger", m.fingers, ""),
+		},
+	}
+}
+
+// skipgramMetric finds the same finger pressing two keys with other
+// fingers' keys in between, weighed by how many there are.
+type skipgramMetric struct {
+	weights         []float64
+	includeRepeated bool
+	presses         []SequenceEvent
+	counts          map[string]int
+	distances       []CountEntry
+	fingers         [10]float64
+	total           float64
+}
+
+func newSkipgramMetric(weights []float64, includeRepeated bool) *skipgramMetric {
+	m := skipgramMetric{
+		weights:         weights,
+		includeRepeated: includeRepeated,
+		counts:          make(map[string]int),
+		distances:       make([]CountEntry, len(weights)),
+	}
+
+	for i := range m.distances {
+		m.distances[i].Label = fmt.Sprintf("%d between", i+1)
+	}
+
+	return &m
+}
+
+func (m *skipgramMetric) Observe(event SequenceEvent) {
+	if !soloPress(event) {
+		return
+	}
+
+	// the closest earlier press by the same finger makes the skipgram,
+	// unless it was right before and so a same finger bigram
+	for gap := 1; gap <= len(m.weights) && gap < len(m.presses); gap++ {
+		previous := m.presses[len(m.presses)-1-gap]
+		if m.presses[len(m.presses)-gap].Finger == event.Finger {
+			break
+		}
+		if previous.Finger != event.Finger {
+			continue
+		}
+
+		if previous.Val != event.Val || m.includeRepeated {
+			m.counts[pressLabel(previous.Val, event.Val)] += 1
+			m.distances[gap-1].Value += 1
+			m.fingers[event.Finger-1] += m.weights[gap-1]
+			m.total += m.weights[gap-1]
+		}
+		break
+	}
+
+	m.presses = append(m.presses, event)
+	if len(m.presses) > len(m.weights)+1 {
+		m.presses = m.presses[1:]
+	}
+}
+
+func (m *skipgramMetric) Finalize() MetricResult {
+	for i := range m.fingers {
+		m.fingers[i] = math.Round(m.fingers[i]*100) / 100
+	}
+
+	return MetricResult{
+		Values: []MetricValue{{Name: "skipgram", Label: "Weighted Skipgrams", Value: math.Round(m.total*100) / 100}},
+		Tables: []MetricTable{
+			{Title: "By Distance", Entries: m.distances},
+			{Title: "By Key Pair", Entries: countEntries(m.counts)},
+			fingerTable("By Finger", m.fingers, ""),
+		},
+	}
+}
+
+type stretchMetric struct {
+	layout           Layout
+	lastPress        SequenceEvent
+	lateralStretches map[string]int
+	scissors         map[string]int
+	halfScissors     map[string]int
+	lateralTotal     int
+	scissorTotal     int
+	halfScissorTotal int
+}
+
+func (m *stretchMetric) Observe(event SequenceEvent) {
+	if !soloPress(event) {
+		return
+	}
+
+	if m.lastPress.Finger != 0 {
+		p1 := m.layout[m.lastPress.Index]
+		p2 := m.layout[event.Index]
+		key := pressLabel(m.lastPress.Val, event.Val)
+
+		if IsLateralStretch(m.lastPress.Finger, p1, event.Finger, p2) {
+			m.lateralStretches[key] += 1
+			m.lateralTotal += 1
+		}
+
+		switch Scissor(m.lastPress.Finger, p1, event.Finger, p2) {
+		case FullScissor:
+			m.scissors[key] += 1
+			m.scissorTotal += 1
+		case HalfScissor:
+			m.halfScissors[key] += 1
+			m.halfScissorTotal += 1
+		}
+	}
+
+	m.lastPress = event
+}
+
+func (m *stretchMetric) Finalize() MetricResult {
+	return MetricResult{
+		Values: []MetricValue{
+			{Name: "lateral_stretch", Label: "Lateral Stretch Bigrams", Value: float64(m.lateralTotal)},
+			{Name: "scissor", Label: "Full Scissors", Value: float64(m.scissorTotal)},
+			{Name: "half_scissor", Label: "Half Scissors", Value: float64(m.halfScissorTotal)},
+		},
+		Tables: []MetricTable{
+			{Title: "Lateral Stretch Bigrams", Entries: countEntries(m.lateralStretches)},
+			{Title: "Full Scissors", Entries: countEntries(m.scissors)},
+			{Title: "Half Scissors", Entries: countEntries(m.halfScissors)},
+		},
+	}
+}
+
+type layerMetric struct {
+	switches int
+	counts   []int
+}
+
+func (m *layerMetric) Observe(event SequenceEvent) {
+	if event.Action == "release" {
+		return
+	}
+
+	if strings.Contains(event.Action, "layer") {
+		m.switches += 1
+	}
+
+	if !countedEvent(event) {
+		return
+	}
+
+	for len(m.counts) < event.Layer+1 {
+		m.counts = append(m.counts, 0)
+	}
+	m.counts[event.Layer] += 1
+}
+
+func (m *layerMetric) Finalize() MetricResult {
+	entries := []CountEntry{}
+	for layer, count := range m.counts {
+		entries = append(entries, CountEntry{Label: fmt.Sprintf("Layer %d", layer), Value: count})
+	}
+
+	return MetricResult{
+		Values: []MetricValue{
+			{Name: "layer_switches", Label: "Layer Switches", Value: float64(m.switches)},
+			{Name: "layers_used", Label: "Layers Utilized", Value: float64(len(m.counts))},
+		},
+		Tables: []MetricTable{{Title: "Key Presses By Layer", Entries: entries}},
+	}
+}
+
+// travelMetric adds up how far each finger moves, weighed by the same
+// movement costs keys are chosen by. Fingers start on their home keys, and
+// the way back home after sitting idle isn't counted.
+type travelMetric struct {
+	layout       Layout
+	weights      [10]MovementCost
+	pitch        KeyPitch
+	home         [10]int
+	returnHome   int
+	lastLocation [10]int
+	idle         [10]int
+	travel       [10]float64
+}
+
+func (m *travelMetric) Observe(event SequenceEvent) {
+	if !countedEvent(event) || !isKeyDown(event.Action) {
+		return
+	}
+
+	lastLocation := m.lastLocation[event.Finger-1]
+	if lastLocation != -1 {
+		p1 := m.layout[lastLocation]
+		p2 := m.layout[event.Index]
+
+		m.travel[event.Finger-1] += m.weights[event.Finger-1].Distance(event.Finger, p1, p2, m.pitch)
+	}
+
+	m.lastLocation[event.Finger-1] = event.Index
+	returnFingers(&m.lastLocation, &m.idle, m.home, m.returnHome, event.Finger)
+}
+
+func (m *travelMetric) Finalize() MetricResult {
+	// the total is left unrounded so scoring profiles don't weigh it in
+	// steps of a whole meter
+	total := 0.0
+	for i := range m.travel {
+		total += m.travel[i]
+		m.travel[i] = math.Round(m.travel[i])
+	}
+
+	return MetricResult{
+		Values: []MetricValue{{Name: "travel", Label: "Total Travel", Value: total / 1000, Unit: "m"}},
+		Tables: []MetricTable{fingerTable("By Finger", m.travel, "mm")},
+	}
+}
+
+// offHomeMetric finds how much of the time each finger with a home key
+// spends away from it, checked after every key press.
+type offHomeMetric struct {
+	home       [10]int
+	returnHome int
+	locations  [10]int
+	idle       [10]int
+	presses    int
+	off        [10]int
+}
+
+func (m *offHomeMetric) Observe(event SequenceEvent) {
+	if !countedEvent(event) || !isKeyDown(event.Action) {
+		return
+	}
+
+	m.locations[event.Finger-1] = event.Index
+	returnFingers(&m.locations, &m.idle, m.home, m.returnHome, event.Finger)
+
+	m.presses += 1
+	for i, home := range m.home {
+		if home != -1 && m.locations[i] != home {
+			m.off[i] += 1
+		}
+	}
+}
+
+func (m *offHomeMetric) Finalize() MetricResult {
+	percent := func(off, presses int) float64 {
+		if presses == 0 {
+			return 0
+		}
+		return math.Round(float64(off)/float64(presses)*1000) / 10
+	}
+
+	fingers := [10]float64{}
+	off, homed := 0, 0
+	for i, home := range m.home {
+		if home == -1 {
+			continue
+		}
+
+		fingers[i] = percent(m.off[i], m.presses)
+		off += m.off[i]
+		homed += 1
+	}
+
+	return MetricResult{
+		Values: []MetricValue{{Name: "off_home", Label: "Time Off Home", Value: percent(off, m.presses*homed), Unit: "%"}},
+		Tables: []MetricTable{fingerTable("By Finger", fingers, "%")},
+	}
+}
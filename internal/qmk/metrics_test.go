@@ -0,0 +1,73 @@
+package qmk
+
+import (
+	"errors"
+	"testing"
+)
+
+// thumbMetric counts keys pressed by either thumb.
+type thumbMetric struct {
+	presses int
+}
+
+func (m *thumbMetric) Observe(event SequenceEvent) {
+	if soloPress(event) && (event.Finger == 5 || event.Finger == 10) {
+		m.presses += 1
+	}
+}
+
+func (m *thumbMetric) Finalize() MetricResult {
+	return MetricResult{Values: []MetricValue{{Name: "thumb_presses", Label: "Thumb Presses", Value: float64(m.presses)}}}
+}
+
+func TestRegisterMetric(t *testing.T) {
+	info := MetricInfo{
+		Name:   "thumbs",
+		Title:  "Thumbs",
+		Values: []string{"thumb_presses"},
+		New: func(s *Sequencer, includeRepeated bool) Metric {
+			return &thumbMetric{}
+		},
+	}
+	NoError(t, RegisterMetric(info))
+	defer UnregisterMetric("thumbs")
+
+	ArrayContains(t, "thumb_presses", MetricValueNames())
+
+	sequencer := GetSequencer(t)
+	sequencer.Build("Is it")
+	analysis := sequencer.Analyze(false)
+
+	// shift and the space
+	Equal(t, 2.0, analysis.Value("thumb_presses"))
+
+	result, ok := analysis.Metric("thumbs")
+	Equal(t, true, ok)
+	Equal(t, "Thumbs", result.Title)
+
+	// registered metrics run after the builtin ones
+	Equal(t, "thumbs", analysis.Metrics[len(analysis.Metrics)-1].Name)
+
+	profile, err := ParseScoringProfile([]byte(`{"weights": {"thumb_presses": 1.5}}`), "thumbs")
+	NoError(t, err)
+	Equal(t, 3.0, profile.Score(analysis))
+
+	UnregisterMetric("thumbs")
+	_, ok = GetSequencer(t).Analyze(false).Metric("thumbs")
+	Equal(t, false, ok)
+}
+
+func TestRegisterMetricErrors(t *testing.T) {
+	newMetric := func(s *Sequencer, includeRepeated bool) Metric {
+		return &thumbMetric{}
+	}
+
+	err := RegisterMetric(MetricInfo{Name: "sfb", New: newMetric})
+	ErrorEqual(t, errors.New("metric sfb is already registered"), err)
+
+	err = RegisterMetric(MetricInfo{Name: "sfb2", Values: []string{"sfb"}, New: newMetric})
+	ErrorEqual(t, errors.New("metric sfb2: value sfb is already reported by metric sfb"), err)
+
+	err = RegisterMetric(MetricInfo{Name: "nothing"})
+	ErrorEqual(t, errors.New("metric needs a name and a constructor"), err)
+}
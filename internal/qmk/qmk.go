@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	_ "regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -23,9 +24,20 @@ type QMKHelper struct {
 	LayoutLock   sync.Mutex
 	Shutdown     chan bool
 	Ticker       *time.Ticker
-	KeySize      float64
+	// KeySize is how many pixels an MX spaced key is drawn wide and high.
+	KeySize float64
+	// QMKFirmwareDir is the qmk_firmware checkout indexed by
+	// IndexQMKFirmware, if any.
+	QMKFirmwareDir    string
+	layoutIndex       map[string]layoutEntry
+	firmwareKeyboards map[string]firmwareKeyboard
+	firmwareKeymaps   map[string]string
 }
 
+// findKeyboardsRecursive finds the keyboards below sourceDir, named relative
+// to base. As in QMK, a directory is a keyboard when it has its own info.json
+// or keyboard.json, unless there are keyboards below it, which makes it the
+// shared parent of revisions. Helper directories like lib/ have neither.
 func findKeyboardsRecursive(base, sourceDir string) ([]string, error) {
 	names := []string{}
 
@@ -34,20 +46,21 @@ func findKeyboardsRecursive(base, sourceDir string) ([]string, error) {
 		return []string{}, err
 	}
 
-	existingSubdir := false
+	hasInfo := false
 	for _, file := range files {
 		if file.IsDir() && file.Name() != "keymaps" {
 			newNames, err := findKeyboardsRecursive(base, path.Join(sourceDir, file.Name()))
-			existingSubdir = true
 			if err != nil {
 				return []string{}, err
 			}
 
 			names = append(names, newNames...)
+		} else if slices.Contains(keyboardInfoFiles, file.Name()) {
+			hasInfo = true
 		}
 	}
 
-	if !existingSubdir {
+	if hasInfo && len(names) == 0 {
 		names = append(names, strings.TrimPrefix(sourceDir, base))
 	}
 
@@ -101,9 +114,43 @@ func NewQMKHelper(layoutDir, keymapDir, fingermapDir string) (*QMKHelper, error)
 		KeySize:      64,
 	}
 
+	err := q.IndexLayouts()
+	if err != nil {
+		return q, err
+	}
+
 	return q, nil
 }
 
+// NewKeymapSequencer builds a sequencer for keymap, typed on layout with
+// fingermap. It has the keymap's combos, the fingermap's home keys and
+// movement costs, and the key spacing of the keymap's own keyboard, so
+// keymaps compared on one layout are each measured on their own board.
+func (q *QMKHelper) NewKeymapSequencer(keymap *KeymapData, fingermap Fingermap, layout Layout) (*Sequencer, error) {
+	layers, err := keymap.ParseLayers()
+	if err != nil {
+		return nil, err
+	}
+
+	keyfinder, err := CreateKeyfinder(layers, fingermap)
+	if err != nil {
+		return nil, err
+	}
+
+	combos, err := CreateCombos(*keymap, fingermap)
+	if err != nil {
+		return nil, err
+	}
+
+	sequencer := NewSequencer(keyfinder, layout)
+	sequencer.Combos = combos
+	sequencer.MovementWeights = fingermap.MovementWeights()
+	sequencer.Home = fingermap.HomeKeys()
+	sequencer.Pitch = q.GetPitchForKeymap(keymap)
+
+	return sequencer, nil
+}
+
 func (q *QMKHelper) ApplyKeymap(keyboard *Keyboard, keymap *KeymapData, layer int) error {
 	if keymap.Layers != nil {
 		keyboard.LayerCount = len(keymap.Layers)
@@ -123,23 +170,29 @@ func (q *QMKHelper) ApplyKeymap(keyboard *Keyboard, keymap *KeymapData, layer in
 		return errors.New(fmt.Sprintf("number of keys in keymap (%d) does not match number of keys in layout (%d) for %s", len(keymap.Layers[0]), len(keyboard.Keys), keymap.Keymap))
 	}
 
+	table, err := GetKeycodeTable(keymap.KeycodeVersion)
+	if err != nil {
+		return err
+	}
+
 	for i := range keyboard.Keys {
 		keyboard.Keys[i].Keycap.Raw = keymap.Layers[layer][i]
-		queue := CreateQueue(keyboard.Keys[i].Keycap.Raw)
+		queue := CreateQueue(keymap.resolveTapDance(keyboard.Keys[i].Keycap.Raw))
+		queue.keycodes = table
 		keycode, err := queue.Parse()
 		if err != nil {
 			keyboard.Keys[i].Keycap.Main = keyboard.Keys[i].Keycap.Raw
 			fmt.Printf("%+v\nUsing raw %s\n\n", err, keyboard.Keys[i].Keycap.Raw)
 		} else {
-			keyboard.Keys[i].Keycap.Main = keycode.Default
+			keyboard.Keys[i].Keycap.Main = keycode.Output()
 			if strings.ToLower(keycode.Default) == strings.ToLower(keycode.Shift) {
 				keyboard.Keys[i].Keycap.Main = keycode.Shift
 			} else {
 				keyboard.Keys[i].Keycap.Shift = keycode.Shift
 				keyboard.Keys[i].Keycap.MainSize *= 0.75
 			}
-			if strings.ToLower(keycode.Default) != strings.ToLower(keycode.Hold) {
-				keyboard.Keys[i].Keycap.Hold = keycode.Hold
+			if strings.ToLower(keycode.Default) != strings.ToLower(keycode.HoldLabel()) {
+				keyboard.Keys[i].Keycap.Hold = keycode.HoldLabel()
 			}
 		}
 	}
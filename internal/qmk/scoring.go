@@ -0,0 +1,174 @@
+package qmk
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// scoreCharacters is the length of text counts are scaled to when a profile
+// normalizes them.
+const scoreCharacters = 100
+
+// ScoringProfile weighs the metrics of an analysis into a single score, the
+// lower the better, so keymaps can be ranked by what matters to whoever is
+// typing on them. Negative weights reward a metric, such as rolls.
+type ScoringProfile struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Weights     map[string]float64 `json:"weights"`
+	// Normalize scales every count to 100 characters of text, so scores of
+	// texts of different lengths can be compared.
+	Normalize bool `json:"normalize,omitempty"`
+	// FingerPenalties is added for every key press of a finger, in fingermap
+	// order from the left pinky to the right thumb.
+	FingerPenalties []float64 `json:"finger_penalties,omitempty"`
+}
+
+// DefaultScoringProfile is the score the analyzer has always reported.
+var DefaultScoringProfile = ScoringProfile{
+	Name:        "default",
+	Description: "Same finger bigrams, layer switches and finger travel in meters",
+	Weights: map[string]float64{
+		"sfb":            0.25,
+		"layer_switches": 0.125,
+		"travel":         1,
+	},
+}
+
+// BuiltinScoringProfiles are the presets offered alongside profiles loaded
+// from files.
+var BuiltinScoringProfiles = []ScoringProfile{
+	DefaultScoringProfile,
+	{
+		Name:        "comfort",
+		Description: "Avoids same finger use, stretches, scissors and pinky presses",
+		Normalize:   true,
+		Weights: map[string]float64{
+			"sfb":             4,
+			"skipgram":        1,
+			"lateral_stretch": 2,
+			"scissor":         3,
+			"half_scissor":    1,
+			"bad_redirect":    2,
+			"travel":          1,
+		},
+		FingerPenalties: []float64{0.2, 0.05, 0, 0, 0, 0.2, 0.05, 0, 0, 0},
+	},
+	{
+		Name:        "speed",
+		Description: "Rewards rolls and alternation, punishes same finger use and redirects",
+		Normalize:   true,
+		Weights: map[string]float64{
+			"sfb":          5,
+			"skipgram":     2,
+			"redirect":     1,
+			"bad_redirect": 2,
+			"inward_roll":  -1,
+			"outward_roll": -0.5,
+			"alternation":  -0.5,
+		},
+	},
+	{
+		Name:        "layers",
+		Description: "Keeps layer switches to a minimum",
+		Normalize:   true,
+		Weights: map[string]float64{
+			"layer_switches": 2,
+			"sfb":            1,
+			"travel":         1,
+		},
+	},
+}
+
+// Validate checks the profile only weighs metrics the analyzer knows.
+func (p ScoringProfile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("scoring profile has no name")
+	}
+
+	names := MetricValueNames()
+	for name := range p.Weights {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("scoring profile %s: unknown metric %s, expected one of %s", p.Name, name, strings.Join(names, ", "))
+		}
+	}
+
+	if len(p.FingerPenalties) != 0 && len(p.FingerPenalties) != 10 {
+		return fmt.Errorf("scoring profile %s: finger_penalties needs 10 fingers, got %d", p.Name, len(p.FingerPenalties))
+	}
+
+	return nil
+}
+
+// Score weighs the metric values of data, rounded to two decimals.
+func (p ScoringProfile) Score(data AnalysisData) float64 {
+	score := 0.0
+	for name, weight := range p.Weights {
+		score += weight * data.Value(name)
+	}
+
+	presses, _ := data.Table("fingers", "By Finger")
+	for i, penalty := range p.FingerPenalties {
+		if i < len(presses.Fingers) {
+			score += penalty * presses.Fingers[i]
+		}
+	}
+
+	if p.Normalize && data.Characters > 0 {
+		score = score * scoreCharacters / float64(data.Characters)
+	}
+
+	return math.Round(score*100) / 100
+}
+
+// ParseScoringProfile reads a profile from JSON or HJSON, see DecodeConfig.
+// Profiles without a name are called name.
+func ParseScoringProfile(b []byte, name string) (ScoringProfile, error) {
+	profile := ScoringProfile{}
+	err := DecodeConfig(b, &profile)
+	if err != nil {
+		return profile, err
+	}
+
+	if profile.Name == "" {
+		profile.Name = name
+	}
+
+	return profile, profile.Validate()
+}
+
+// LoadScoringProfiles reads every profile in dir, named after their file
+// unless they name themselves.
+func LoadScoringProfiles(dir string) ([]ScoringProfile, error) {
+	profiles := []ScoringProfile{}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return profiles, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || (path.Ext(entry.Name()) != ".json" && path.Ext(entry.Name()) != ".hjson") {
+			continue
+		}
+
+		filePath := path.Join(dir, entry.Name())
+		b, err := os.ReadFile(filePath)
+		if err != nil {
+			return profiles, err
+		}
+
+		profile, err := ParseScoringProfile(b, strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())))
+		if err != nil {
+			return profiles, fmt.Errorf("%s: %w", filePath, err)
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
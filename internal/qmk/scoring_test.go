@@ -0,0 +1,52 @@
+package qmk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScoringProfile(t *testing.T) {
+	data := AnalysisData{
+		Characters: 50,
+		Metrics: []MetricResult{
+			{Name: "fingers", Tables: []MetricTable{{Title: "By Finger", Fingers: []float64{3, 0, 0, 0, 0, 1, 0, 0, 0, 0}}}},
+			{Name: "sfb", Values: []MetricValue{{Name: "sfb", Value: 4}}},
+			{Name: "layers", Values: []MetricValue{{Name: "layer_switches", Value: 8}}},
+			{Name: "travel", Values: []MetricValue{{Name: "travel", Value: 2}}},
+			{Name: "trigrams", Values: []MetricValue{{Name: "inward_roll", Value: 2}}},
+		},
+	}
+
+	// the score the analyzer has always reported
+	Equal(t, 4.0, DefaultScoringProfile.Score(data))
+
+	profiles, err := LoadScoringProfiles("./test_content/scoring")
+	NoError(t, err)
+	Equal(t, 1, len(profiles))
+	Equal(t, "pinkies", profiles[0].Name)
+
+	// (4 sfbs - 2 rolls + 4 pinky presses) for every 100 of 50 characters
+	Equal(t, 12.0, profiles[0].Score(data))
+
+	for _, profile := range BuiltinScoringProfiles {
+		NoError(t, profile.Validate())
+	}
+}
+
+func TestScoringProfileErrors(t *testing.T) {
+	_, err := ParseScoringProfile([]byte(`{"weights": {"sfbs": 1}}`), "typo")
+	ErrorEqual(t, errors.New("scoring profile typo: unknown metric sfbs, expected one of alternation, bad_redirect, effort, effort_base, effort_penalty, effort_stroke, half_scissor, inward_roll, key_presses, lateral_stretch, layer_switches, layers_used, off_home, one_hand, other_trigram, outward_roll, redirect, scissor, sfb, skipgram, travel, trigrams"), err)
+
+	_, err = ParseScoringProfile([]byte(`{"finger_penalties": [1, 2]}`), "short")
+	ErrorEqual(t, errors.New("scoring profile short: finger_penalties needs 10 fingers, got 2"), err)
+}
+
+func TestAnalysisScore(t *testing.T) {
+	sequencer := GetSequencer(t)
+	sequencer.Build("hello")
+
+	analysis := sequencer.Analyze(true)
+	Equal(t, 5, analysis.Characters)
+	Equal(t, "default", analysis.ScoringProfile)
+	Equal(t, DefaultScoringProfile.Score(analysis), analysis.Score)
+}
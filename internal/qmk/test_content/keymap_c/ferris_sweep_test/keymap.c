@@ -0,0 +1,39 @@
+// Copyright 2024 test
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+#include QMK_KEYBOARD_H
+
+enum layers {
+    _BASE,
+    _NUM, /* numbers on the bottom row */
+};
+
+enum custom_keycodes {
+    MACRO_1 = SAFE_RANGE,
+    MACRO_2,
+};
+
+#define NUM_ENT LT(_NUM, KC_ENT)
+#define SHIFT KC_LSFT
+#define ___x___ KC_TRNS
+#define MY_LAYOUT LAYOUT_split_3x5_2
+#define HOME_A(kc) LGUI_T(kc)
+
+const uint16_t PROGMEM keymaps[][MATRIX_ROWS][MATRIX_COLS] = {
+    [_BASE] = MY_LAYOUT(
+        KC_Y, KC_C, KC_L, KC_M, KC_K,      KC_Z, KC_F, KC_U, KC_COMM, KC_QUOT,
+        KC_I, KC_S, KC_R, KC_T, KC_G,      KC_P, KC_N, KC_E, KC_A,    KC_O,
+        KC_V, KC_W, KC_J, KC_D, KC_Q,      KC_B, KC_H, KC_SLSH, KC_DOT, KC_X,
+                    SHIFT, KC_SPC,         NUM_ENT, KC_BSPC
+    ),
+
+    /*
+     * Numbers, everything else falls through
+     */
+    [_NUM] = LAYOUT_split_3x5_2(
+        _______, _______, _______, _______, _______,      ___x___, ___x___, ___x___, ___x___, ___x___,
+        _______, _______, _______, _______, _______,      _______, _______, _______, _______, _______,
+        KC_5,    KC_6,    KC_7,    KC_8,    KC_9,         KC_0,    KC_1,    KC_2,    KC_3,    KC_4,
+                          _______, _______,               _______, _______
+    )
+};
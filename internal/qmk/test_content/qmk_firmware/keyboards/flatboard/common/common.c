@@ -0,0 +1 @@
+// helpers shared by the keyboard, not a keyboard
@@ -0,0 +1 @@
+// helpers shared by every revision, not a keyboard
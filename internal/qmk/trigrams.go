@@ -0,0 +1,174 @@
+package qmk
+
+// TrigramKind is the community category of three consecutive key presses.
+type TrigramKind int
+
+const (
+	// Alternation switches hands on every key.
+	Alternation TrigramKind = iota
+	// InwardRoll and OutwardRoll press two keys on one hand, towards the
+	// index finger or away from it, and one on the other hand.
+	InwardRoll
+	OutwardRoll
+	// OneHand presses all three keys on one hand in a single direction.
+	OneHand
+	// Redirect presses all three keys on one hand, changing direction.
+	Redirect
+	// BadRedirect is a redirect that doesn't use the index finger.
+	BadRedirect
+	// OtherTrigram holds everything else, such as same finger bigrams and
+	// thumb keys on the same hand as the fingers around them.
+	OtherTrigram
+)
+
+// TrigramKinds lists every category in the order they are reported.
+var TrigramKinds = []TrigramKind{Alternation, InwardRoll, OutwardRoll, OneHand, Redirect, BadRedirect, OtherTrigram}
+
+// trigramTopN is how many of the most common trigrams each category keeps.
+const trigramTopN = 10
+
+func (k TrigramKind) String() string {
+	switch k {
+	case Alternation:
+		return "Alternation"
+	case InwardRoll:
+		return "Inward Roll"
+	case OutwardRoll:
+		return "Outward Roll"
+	case OneHand:
+		return "One-Hand"
+	case Redirect:
+		return "Redirect"
+	case BadRedirect:
+		return "Bad Redirect"
+	}
+
+	return "Other"
+}
+
+// ClassifyTrigram categorizes key presses by fingers f1, f2 and f3 of a
+// fingermap.
+func ClassifyTrigram(f1, f2, f3 int) TrigramKind {
+	if f1 == f2 || f2 == f3 {
+		return OtherTrigram
+	}
+
+	hand1, finger1 := fingerHand(f1)
+	hand2, finger2 := fingerHand(f2)
+	hand3, finger3 := fingerHand(f3)
+
+	if hand1 != hand2 && hand2 != hand3 {
+		return Alternation
+	}
+
+	if hand1 == hand2 && hand2 == hand3 {
+		if finger1 == thumbFinger || finger2 == thumbFinger || finger3 == thumbFinger {
+			return OtherTrigram
+		}
+
+		// fingers count up from the pinky, so an increase moves inwards
+		if (finger2 > finger1) == (finger3 > finger2) {
+			return OneHand
+		}
+
+		if finger1 == indexFinger || finger2 == indexFinger || finger3 == indexFinger {
+			return Redirect
+		}
+
+		return BadRedirect
+	}
+
+	first, second := finger1, finger2
+	if hand1 != hand2 {
+		first, second = finger2, finger3
+	}
+
+	if first == thumbFinger || second == thumbFinger {
+		return OtherTrigram
+	}
+
+	if second > first {
+		return InwardRoll
+	}
+
+	return OutwardRoll
+}
+
+// valueName is how scoring profiles refer to the category.
+func (k TrigramKind) valueName() string {
+	switch k {
+	case Alternation:
+		return "alternation"
+	case InwardRoll:
+		return "inward_roll"
+	case OutwardRoll:
+		return "outward_roll"
+	case OneHand:
+		return "one_hand"
+	case Redirect:
+		return "redirect"
+	case BadRedirect:
+		return "bad_redirect"
+	}
+
+	return "other_trigram"
+}
+
+func trigramValueNames() []string {
+	names := []string{}
+	for _, kind := range TrigramKinds {
+		names = append(names, kind.valueName())
+	}
+
+	return names
+}
+
+// trigramMetric classifies every three keys pressed on their own in a row.
+// Shift and layer keys are presses of their own, so they take part.
+type trigramMetric struct {
+	presses []SequenceEvent
+	counts  map[TrigramKind]map[string]int
+	total   int
+}
+
+func (m *trigramMetric) Observe(event SequenceEvent) {
+	if !soloPress(event) {
+		return
+	}
+
+	if len(m.presses) == 2 {
+		first, second := m.presses[0], m.presses[1]
+		kind := ClassifyTrigram(first.Finger, second.Finger, event.Finger)
+		if m.counts[kind] == nil {
+			m.counts[kind] = make(map[string]int)
+		}
+		m.counts[kind][pressLabel(first.Val, second.Val, event.Val)] += 1
+		m.total += 1
+
+		m.presses = m.presses[1:]
+	}
+
+	m.presses = append(m.presses, event)
+}
+
+func (m *trigramMetric) Finalize() MetricResult {
+	result := MetricResult{
+		Values: []MetricValue{{Name: "trigrams", Label: "Total Trigrams", Value: float64(m.total)}},
+	}
+
+	for _, kind := range TrigramKinds {
+		total := 0
+		for _, count := range m.counts[kind] {
+			total += count
+		}
+		result.Values = append(result.Values, MetricValue{Name: kind.valueName(), Label: kind.String(), Value: float64(total)})
+
+		top := countEntries(m.counts[kind])
+		if len(top) > trigramTopN {
+			top = top[:trigramTopN]
+		}
+		result.Tables = append(result.Tables, MetricTable{Title: kind.String(), Entries: top})
+	}
+
+	return result
+}
@@ -0,0 +1,47 @@
+package qmk
+
+import "testing"
+
+func TestClassifyTrigram(t *testing.T) {
+	// left hand fingers are 1-5 from the pinky, right hand 6-10
+	Equal(t, Alternation, ClassifyTrigram(4, 7, 4))
+	Equal(t, InwardRoll, ClassifyTrigram(2, 3, 8))
+	Equal(t, InwardRoll, ClassifyTrigram(3, 8, 9))
+	Equal(t, OutwardRoll, ClassifyTrigram(4, 2, 9))
+	Equal(t, OneHand, ClassifyTrigram(1, 2, 3))
+	Equal(t, OneHand, ClassifyTrigram(9, 8, 6))
+	Equal(t, Redirect, ClassifyTrigram(2, 4, 3))
+	Equal(t, BadRedirect, ClassifyTrigram(2, 1, 2))
+	// same finger bigrams and thumbs next to fingers of their hand
+	Equal(t, OtherTrigram, ClassifyTrigram(2, 2, 8))
+	Equal(t, OtherTrigram, ClassifyTrigram(5, 2, 3))
+	Equal(t, OtherTrigram, ClassifyTrigram(8, 5, 4))
+	Equal(t, Alternation, ClassifyTrigram(5, 8, 3))
+}
+
+func TestTrigramAnalysis(t *testing.T) {
+	sequencer := GetSequencer(t)
+
+	text := "Isre"
+	sequencer.Build(text)
+	Equal(t, text, sequencer.String(true))
+
+	analysis := sequencer.Analyze(true)
+
+	// shift is pressed by the left thumb before the i
+	Equal(t, 3.0, analysis.Value("trigrams"))
+
+	expected := map[TrigramKind][]CountEntry{
+		InwardRoll:   {{Label: "sre", Value: 1}},
+		OneHand:      {{Label: "Isr", Value: 1}},
+		OtherTrigram: {{Label: "<lsft>Is", Value: 1}},
+	}
+
+	for _, kind := range TrigramKinds {
+		Equal(t, float64(len(expected[kind])), analysis.Value(kind.valueName()))
+
+		top, ok := analysis.Table("trigrams", kind.String())
+		Equal(t, true, ok)
+		ArrayEqual(t, expected[kind], top.Entries)
+	}
+}
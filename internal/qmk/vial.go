@@ -0,0 +1,245 @@
+package qmk
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var tapDanceRegex = regexp.MustCompile(`^TD\((\d+)\)$`)
+
+// Combo sends Output when all of its keys are pressed together. Keys are
+// matched by keycode, like QMK does, or by layout index with Positions, like
+// ZMK does. An empty Layers means the combo works on every layer.
+type Combo struct {
+	Keys      []string `json:"keys,omitempty"`
+	Positions []int    `json:"positions,omitempty"`
+	Layers    []int    `json:"layers,omitempty"`
+	Output    string   `json:"output"`
+}
+
+// TapDance is a TD(n) key. Only the tap and hold actions are used for
+// analysis, the double tap variants are kept so exports round trip.
+type TapDance struct {
+	OnTap       string `json:"on_tap"`
+	OnHold      string `json:"on_hold"`
+	OnDoubleTap string `json:"on_double_tap"`
+	OnTapHold   string `json:"on_tap_hold"`
+	TappingTerm int    `json:"tapping_term"`
+}
+
+// Keycode returns the plain keycode that behaves like the tap dance when it
+// is tapped or held, e.g. LT(1,KC_A) for a tap of KC_A and a hold of MO(1).
+func (td TapDance) Keycode() string {
+	if td.OnTap == "" || td.OnTap == "KC_NO" {
+		return td.OnHold
+	}
+
+	if td.OnHold == "" || td.OnHold == "KC_NO" {
+		return td.OnTap
+	}
+
+	node, err := ParseKeycode(td.OnHold)
+	if err != nil {
+		return td.OnTap
+	}
+
+	if layerNode, ok := node.(LayerFunctionNode); ok && layerNode.Function == "MO" {
+		return fmt.Sprintf("LT(%d,%s)", layerNode.Layer, td.OnTap)
+	}
+
+	queue := CreateQueue(td.OnHold)
+	hold, err := queue.Parse()
+	if err == nil && hold.HoldMods != 0 {
+		return fmt.Sprintf("MT(%s,%s)", hold.HoldMods.Constant(), td.OnTap)
+	}
+
+	return td.OnTap
+}
+
+// resolveTapDance replaces a TD(n) keycode with its tap dance's equivalent,
+// any other keycode is returned unchanged.
+func (km *KeymapData) resolveTapDance(keycode string) string {
+	match := tapDanceRegex.FindStringSubmatch(keycode)
+	if match == nil {
+		return keycode
+	}
+
+	index, _ := strconv.Atoi(match[1])
+	if index >= len(km.TapDances) {
+		return keycode
+	}
+
+	return km.TapDances[index].Keycode()
+}
+
+type vialExport struct {
+	Layout   [][][]any  `json:"layout"`
+	TapDance [][]any    `json:"tap_dance"`
+	Combo    [][]string `json:"combo"`
+}
+
+type viaExport struct {
+	Name   string     `json:"name"`
+	Layers [][]string `json:"layers"`
+}
+
+// ParseVial reads a Vial .vil export. Vial saves each layer as matrix rows of
+// columns, which are put back in layout order with the layout's matrix
+// positions. Tap dances and combos are brought along so the sequencer can
+// use them.
+func ParseVial(data []byte, name, layoutName string, layout Layout, keymapData *KeymapData) error {
+	export := vialExport{}
+	err := DecodeConfig(data, &export)
+	if err != nil {
+		return err
+	}
+
+	if len(export.Layout) == 0 {
+		return fmt.Errorf("vial export has no layers")
+	}
+
+	keymapData.Layers = [][]string{}
+	for layer, rows := range export.Layout {
+		matrix := [][]string{}
+		for _, row := range rows {
+			keys := []string{}
+			for _, key := range row {
+				// unused matrix positions are saved as -1
+				keycode, ok := key.(string)
+				if !ok {
+					keycode = "KC_NO"
+				}
+				keys = append(keys, keycode)
+			}
+			matrix = append(matrix, keys)
+		}
+
+		keys, err := matrixToLayout(matrix, layout)
+		if err != nil {
+			return fmt.Errorf("layer %d: %w", layer, err)
+		}
+
+		keymapData.Layers = append(keymapData.Layers, keys)
+	}
+
+	keymapData.TapDances = []TapDance{}
+	for i, entry := range export.TapDance {
+		if len(entry) != 5 {
+			return fmt.Errorf("tap dance %d: expected 5 fields, got %d", i, len(entry))
+		}
+
+		keycodes := [4]string{}
+		for j := range keycodes {
+			keycodes[j], _ = entry[j].(string)
+		}
+		term, _ := entry[4].(float64)
+
+		keymapData.TapDances = append(keymapData.TapDances, TapDance{
+			OnTap:       keycodes[0],
+			OnHold:      keycodes[1],
+			OnDoubleTap: keycodes[2],
+			OnTapHold:   keycodes[3],
+			TappingTerm: int(term),
+		})
+	}
+
+	keymapData.Combos = []Combo{}
+	for i, entry := range export.Combo {
+		if len(entry) != 5 {
+			return fmt.Errorf("combo %d: expected 5 fields, got %d", i, len(entry))
+		}
+
+		// Vial always saves four trigger keys, unused slots are KC_NO
+		combo := Combo{Keys: []string{}, Output: entry[4]}
+		for _, key := range entry[:4] {
+			if key != "KC_NO" {
+				combo.Keys = append(combo.Keys, key)
+			}
+		}
+
+		if len(combo.Keys) < 2 || combo.Output == "KC_NO" {
+			continue
+		}
+
+		keymapData.Combos = append(keymapData.Combos, combo)
+	}
+
+	keymapData.Version = 1
+	keymapData.Keymap = name
+	keymapData.Layout = layoutName
+
+	return nil
+}
+
+// ParseVIA reads a VIA keymap export, where each layer is the switch matrix
+// flattened row by row.
+func ParseVIA(data []byte, name, layoutName string, layout Layout, keymapData *KeymapData) error {
+	export := viaExport{}
+	err := DecodeConfig(data, &export)
+	if err != nil {
+		return err
+	}
+
+	if len(export.Layers) == 0 {
+		return fmt.Errorf("via export has no layers")
+	}
+
+	rows := 0
+	for _, key := range layout {
+		if len(key.Matrix) == 2 {
+			rows = max(rows, key.Matrix[0]+1)
+		}
+	}
+
+	if rows == 0 || len(export.Layers[0])%rows != 0 {
+		return fmt.Errorf("via layer of %d keys does not fit a matrix of %d rows", len(export.Layers[0]), rows)
+	}
+	cols := len(export.Layers[0]) / rows
+
+	keymapData.Layers = [][]string{}
+	for layer, flat := range export.Layers {
+		matrix := [][]string{}
+		for start := 0; start < len(flat); start += cols {
+			matrix = append(matrix, flat[start:min(start+cols, len(flat))])
+		}
+
+		keys, err := matrixToLayout(matrix, layout)
+		if err != nil {
+			return fmt.Errorf("layer %d: %w", layer, err)
+		}
+
+		keymapData.Layers = append(keymapData.Layers, keys)
+	}
+
+	if name == "" {
+		name = export.Name
+	}
+
+	keymapData.Version = 1
+	keymapData.Keymap = name
+	keymapData.Layout = layoutName
+
+	return nil
+}
+
+// matrixToLayout reorders the keys of a layer from matrix order into layout
+// order. Positions outside the matrix are read as KC_NO.
+func matrixToLayout(matrix [][]string, layout Layout) ([]string, error) {
+	keys := []string{}
+	for i, key := range layout {
+		if len(key.Matrix) != 2 {
+			return nil, fmt.Errorf("layout key %d has no matrix position", i)
+		}
+
+		row, col := key.Matrix[0], key.Matrix[1]
+		if row < 0 || row >= len(matrix) || col < 0 || col >= len(matrix[row]) {
+			keys = append(keys, "KC_NO")
+			continue
+		}
+
+		keys = append(keys, matrix[row][col])
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,179 @@
+package qmk
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func getVialKeymap(t *testing.T) (KeymapData, Layout) {
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	layout, err := q.GetLayoutData("LAYOUT_split_3x5_2")
+	NoError(t, err)
+
+	b, err := os.ReadFile("./test_content/vial/ferris_sweep_test.vil")
+	NoError(t, err)
+
+	keymap := KeymapData{}
+	err = ParseVial(b, "ferris_sweep_test", "LAYOUT_split_3x5_2", layout, &keymap)
+	NoError(t, err)
+
+	return keymap, layout
+}
+
+func TestParseVial(t *testing.T) {
+	keymap, _ := getVialKeymap(t)
+
+	expected := KeymapData{}
+	err := LoadKeymapFromJSON("./test_content/keymaps/LAYOUT_split_3x5_2/ferris_sweep_test.json", &expected)
+	NoError(t, err)
+
+	Equal(t, "ferris_sweep_test", keymap.Keymap)
+	Equal(t, "LAYOUT_split_3x5_2", keymap.Layout)
+	Equal(t, len(expected.Layers), len(keymap.Layers))
+
+	// the vial export uses a tap dance in place of LT(1,KC_ENT)
+	expected.Layers[0][32] = "TD(0)"
+	for i := range expected.Layers {
+		ArrayEqual(t, expected.Layers[i], keymap.Layers[i])
+	}
+
+	Equal(t, 2, len(keymap.TapDances))
+	Equal(t, TapDance{OnTap: "KC_ENTER", OnHold: "MO(1)", OnDoubleTap: "KC_NO", OnTapHold: "KC_NO", TappingTerm: 200}, keymap.TapDances[0])
+
+	// empty combo slots are dropped
+	Equal(t, 1, len(keymap.Combos))
+	ArrayEqual(t, []string{"KC_C", "KC_L"}, keymap.Combos[0].Keys)
+	Equal(t, "KC_MINS", keymap.Combos[0].Output)
+
+	layers, err := keymap.ParseLayers()
+	NoError(t, err)
+	Equal(t, "LT 1", layers[0][32].Hold)
+	Equal(t, "enter", layers[0][32].Default)
+}
+
+func TestParseVIA(t *testing.T) {
+	layout := Layout{
+		{X: 0, Y: 0, Matrix: []int{0, 1}},
+		{X: 1, Y: 0, Matrix: []int{0, 0}},
+		{X: 0, Y: 1, Matrix: []int{1, 0}},
+		{X: 1, Y: 1, Matrix: []int{1, 1}},
+	}
+
+	data := []byte(`{"name": "tiny", "vendorProductId": 1234, "layers": [["KC_A", "KC_B", "KC_C", "KC_D"], ["KC_1", "KC_2", "KC_3", "KC_4"]]}`)
+
+	keymap := KeymapData{}
+	err := ParseVIA(data, "", "LAYOUT_tiny", layout, &keymap)
+	NoError(t, err)
+
+	Equal(t, "tiny", keymap.Keymap)
+	Equal(t, "LAYOUT_tiny", keymap.Layout)
+	Equal(t, 2, len(keymap.Layers))
+	ArrayEqual(t, []string{"KC_B", "KC_A", "KC_C", "KC_D"}, keymap.Layers[0])
+	ArrayEqual(t, []string{"KC_2", "KC_1", "KC_3", "KC_4"}, keymap.Layers[1])
+
+	err = ParseVIA([]byte(`{"layers": [["KC_A", "KC_B", "KC_C"]]}`), "", "LAYOUT_tiny", layout, &keymap)
+	ErrorEqual(t, errors.New("via layer of 3 keys does not fit a matrix of 2 rows"), err)
+
+	layout[2].Matrix = nil
+	err = ParseVIA(data, "", "LAYOUT_tiny", layout, &keymap)
+	ErrorEqual(t, errors.New("layer 0: layout key 2 has no matrix position"), err)
+}
+
+func TestTapDanceKeycode(t *testing.T) {
+	Equal(t, "LT(2,KC_A)", TapDance{OnTap: "KC_A", OnHold: "MO(2)"}.Keycode())
+	Equal(t, "MT(MOD_LCTL,KC_A)", TapDance{OnTap: "KC_A", OnHold: "KC_LCTL"}.Keycode())
+	Equal(t, "KC_A", TapDance{OnTap: "KC_A", OnHold: "KC_NO", OnDoubleTap: "KC_B"}.Keycode())
+	Equal(t, "KC_ESC", TapDance{OnTap: "KC_NO", OnHold: "KC_ESC"}.Keycode())
+}
+
+func TestCombo(t *testing.T) {
+	keymap, layout := getVialKeymap(t)
+
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	fingermap, err := q.LoadFingermapFromJSON("./test_content/fingermaps/LAYOUT_split_3x5_2/ferris_sweep_test.json")
+	NoError(t, err)
+
+	layers, err := keymap.ParseLayers()
+	NoError(t, err)
+
+	keyfinder, err := CreateKeyfinder(layers, fingermap)
+	NoError(t, err)
+
+	combos, err := CreateCombos(keymap, fingermap)
+	NoError(t, err)
+	Equal(t, 1, len(combos["-"]))
+
+	for _, mode := range []SequencerMode{GreedyMode, LookaheadMode} {
+		sequencer := NewSequencer(keyfinder, layout)
+		sequencer.Combos = combos
+		sequencer.Mode = mode
+
+		text := "y-y"
+		sequencer.Build(text)
+		Equal(t, text, sequencer.String(true))
+
+		expected := []SequenceEvent{
+			{Action: "press", KeyPress: KeyPress{Finger: 1, Index: 0, Layer: 0, Val: "y"}},
+			{Action: "release", KeyPress: KeyPress{Finger: 1, Index: 0, Layer: 0, Val: "y"}},
+			{Action: "press", KeyPress: KeyPress{Finger: 2, Index: 1, Layer: 0, Val: "-"}},
+			{Action: "press-combo", KeyPress: KeyPress{Finger: 3, Index: 2, Layer: 0, Val: "-"}},
+			{Action: "release", KeyPress: KeyPress{Finger: 2, Index: 1, Layer: 0, Val: "-"}},
+			{Action: "release", KeyPress: KeyPress{Finger: 3, Index: 2, Layer: 0, Val: "-"}},
+			{Action: "press", KeyPress: KeyPress{Finger: 1, Index: 0, Layer: 0, Val: "y"}},
+			{Action: "release", KeyPress: KeyPress{Finger: 1, Index: 0, Layer: 0, Val: "y"}},
+		}
+		ArrayEqual(t, expected, sequencer.Sequence)
+	}
+}
+
+func TestComboOverKey(t *testing.T) {
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	layout, err := q.GetLayoutData("LAYOUT_split_3x5_2")
+	NoError(t, err)
+
+	keymap, err := q.GetKeymapData("./test_content/keymaps/LAYOUT_split_3x5_2/ferris_sweep_test.json")
+	NoError(t, err)
+	keymap.Combos = []Combo{
+		{Keys: []string{"KC_S", "KC_R"}, Output: "KC_Z"},
+	}
+
+	fingermap, err := q.LoadFingermapFromJSON("./test_content/fingermaps/LAYOUT_split_3x5_2/ferris_sweep_test.json")
+	NoError(t, err)
+
+	layers, err := keymap.ParseLayers()
+	NoError(t, err)
+
+	keyfinder, err := CreateKeyfinder(layers, fingermap)
+	NoError(t, err)
+
+	combos, err := CreateCombos(keymap, fingermap)
+	NoError(t, err)
+
+	for _, mode := range []SequencerMode{GreedyMode, LookaheadMode} {
+		sequencer := NewSequencer(keyfinder, layout)
+		sequencer.Combos = combos
+		sequencer.Mode = mode
+
+		// z is a long reach after h, the combo on the home row is cheaper
+		text := "hz"
+		sequencer.Build(text)
+		Equal(t, text, sequencer.String(true))
+
+		expected := []SequenceEvent{
+			{Action: "press", KeyPress: KeyPress{Finger: 9, Index: 26, Layer: 0, Val: "h"}},
+			{Action: "release", KeyPress: KeyPress{Finger: 9, Index: 26, Layer: 0, Val: "h"}},
+			{Action: "press", KeyPress: KeyPress{Finger: 2, Index: 11, Layer: 0, Val: "z"}},
+			{Action: "press-combo", KeyPress: KeyPress{Finger: 3, Index: 12, Layer: 0, Val: "z"}},
+			{Action: "release", KeyPress: KeyPress{Finger: 2, Index: 11, Layer: 0, Val: "z"}},
+			{Action: "release", KeyPress: KeyPress{Finger: 3, Index: 12, Layer: 0, Val: "z"}},
+		}
+		ArrayEqual(t, expected, sequencer.Sequence)
+	}
+}
@@ -0,0 +1,468 @@
+package qmk
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	zmkNodeRegex     = regexp.MustCompile(`^(?:([A-Za-z_][\w-]*)\s*:\s*)?(&?[A-Za-z_/][\w,@.-]*)$`)
+	zmkFunctionRegex = regexp.MustCompile(`^(\w+)\((.*)\)$`)
+	zmkNumberRegex   = regexp.MustCompile(`^(?:N|NUMBER_)(\d)$`)
+	zmkLetterRegex   = regexp.MustCompile(`^[A-Z]$`)
+	zmkFunctionKey   = regexp.MustCompile(`^F\d+$`)
+)
+
+// zmkKeys maps ZMK key names to QMK keycodes, without the KC_ prefix. Letters,
+// numbers and function keys are handled in zmkKeycode.
+var zmkKeys = map[string]string{
+	"RET": "ENT", "RETURN": "ENT", "ENTER": "ENT",
+	"SPACE": "SPC",
+	"BSPC":  "BSPC", "BACKSPACE": "BSPC",
+	"ESC": "ESC", "ESCAPE": "ESC",
+	"DEL": "DEL", "DELETE": "DEL",
+	"TAB": "TAB",
+	"SQT": "QUOT", "APOS": "QUOT", "APOSTROPHE": "QUOT", "SINGLE_QUOTE": "QUOT",
+	"DQT": "DQUO", "DOUBLE_QUOTES": "DQUO",
+	"COMMA": "COMM",
+	"DOT":   "DOT", "PERIOD": "DOT",
+	"FSLH": "SLSH", "SLASH": "SLSH",
+	"BSLH": "BSLS", "BACKSLASH": "BSLS",
+	"SEMI": "SCLN", "SEMICOLON": "SCLN",
+	"COLON": "COLN",
+	"MINUS": "MINS",
+	"EQUAL": "EQL",
+	"PLUS":  "PLUS",
+	"UNDER": "UNDS", "UNDERSCORE": "UNDS",
+	"LBKT": "LBRC", "LEFT_BRACKET": "LBRC",
+	"RBKT": "RBRC", "RIGHT_BRACKET": "RBRC",
+	"LBRC": "LCBR", "LEFT_BRACE": "LCBR",
+	"RBRC": "RCBR", "RIGHT_BRACE": "RCBR",
+	"LPAR": "LPRN", "LEFT_PARENTHESIS": "LPRN",
+	"RPAR": "RPRN", "RIGHT_PARENTHESIS": "RPRN",
+	"GRAVE": "GRV",
+	"TILDE": "TILD",
+	"EXCL":  "EXLM", "EXCLAMATION": "EXLM",
+	"AT": "AT", "AT_SIGN": "AT",
+	"HASH": "HASH", "POUND": "HASH",
+	"DLLR": "DLR", "DOLLAR": "DLR",
+	"PRCNT": "PERC", "PERCENT": "PERC",
+	"CARET": "CIRC",
+	"AMPS":  "AMPR", "AMPERSAND": "AMPR",
+	"STAR": "ASTR", "ASTRK": "ASTR", "ASTERISK": "ASTR",
+	"PIPE":  "PIPE",
+	"QMARK": "QUES", "QUESTION": "QUES",
+	"LT": "LABK", "LESS_THAN": "LABK",
+	"GT": "RABK", "GREATER_THAN": "RABK",
+	"LEFT": "LEFT", "LEFT_ARROW": "LEFT",
+	"RIGHT": "RGHT", "RIGHT_ARROW": "RGHT",
+	"UP": "UP", "UP_ARROW": "UP",
+	"DOWN": "DOWN", "DOWN_ARROW": "DOWN",
+	"HOME":  "HOME",
+	"END":   "END",
+	"PG_UP": "PGUP", "PAGE_UP": "PGUP",
+	"PG_DN": "PGDN", "PAGE_DOWN": "PGDN",
+	"INS": "INS", "INSERT": "INS",
+	"CAPS": "CAPS", "CAPSLOCK": "CAPS",
+	"LSHFT": "LSFT", "LSHIFT": "LSFT", "LEFT_SHIFT": "LSFT",
+	"RSHFT": "RSFT", "RSHIFT": "RSFT", "RIGHT_SHIFT": "RSFT",
+	"LCTRL": "LCTL", "LCTL": "LCTL", "LEFT_CONTROL": "LCTL",
+	"RCTRL": "RCTL", "RCTL": "RCTL", "RIGHT_CONTROL": "RCTL",
+	"LALT": "LALT", "LEFT_ALT": "LALT",
+	"RALT": "RALT", "RIGHT_ALT": "RALT",
+	"LGUI": "LGUI", "LCMD": "LGUI", "LWIN": "LGUI", "LMETA": "LGUI", "LEFT_GUI": "LGUI",
+	"RGUI": "RGUI", "RCMD": "RGUI", "RWIN": "RGUI", "RMETA": "RGUI", "RIGHT_GUI": "RGUI",
+	"C_VOL_UP": "VOLU", "C_VOLUME_UP": "VOLU",
+	"C_VOL_DN": "VOLD", "C_VOLUME_DOWN": "VOLD",
+	"C_MUTE": "MUTE",
+	"C_PP":   "MPLY", "C_PLAY_PAUSE": "MPLY",
+	"C_NEXT": "MNXT",
+	"C_PREV": "MPRV",
+}
+
+// zmkModFunctions are ZMK's modifier functions, e.g. LS(A) for shift+a.
+var zmkModFunctions = map[string]string{
+	"LS": "LSFT", "RS": "RSFT",
+	"LC": "LCTL", "RC": "RCTL",
+	"LA": "LALT", "RA": "RALT",
+	"LG": "LGUI", "RG": "RGUI",
+}
+
+// zmkLayerBehaviors map ZMK layer behaviors onto QMK layer functions.
+var zmkLayerBehaviors = map[string]string{
+	"mo":  "MO",
+	"to":  "TO",
+	"tog": "TG",
+	"sl":  "OSL",
+}
+
+// zmkSystemBehaviors are parameterless behaviors with a QMK equivalent.
+var zmkSystemBehaviors = map[string]string{
+	"trans":      "KC_TRNS",
+	"none":       "KC_NO",
+	"bootloader": "QK_BOOT",
+	"sys_reset":  "QK_RBT",
+	"caps_word":  "CW_TOGG",
+	"key_repeat": "QK_REP",
+}
+
+// zmkNode is a devicetree node, only as much of the syntax as keymaps use.
+type zmkNode struct {
+	Name     string
+	Label    string
+	Line     int
+	Props    map[string]string
+	Children []*zmkNode
+}
+
+// find returns the first node with the compatible property, or nil.
+func (n *zmkNode) find(compatible string) *zmkNode {
+	found := n.findAll(compatible)
+	if len(found) == 0 {
+		return nil
+	}
+
+	return found[0]
+}
+
+func (n *zmkNode) findAll(compatible string) []*zmkNode {
+	found := []*zmkNode{}
+	if strings.Trim(n.Props["compatible"], `"`) == compatible {
+		found = append(found, n)
+	}
+
+	for _, child := range n.Children {
+		found = append(found, child.findAll(compatible)...)
+	}
+
+	return found
+}
+
+// LoadKeymapFromZMK reads a ZMK .keymap file, see ParseZMKKeymap. ZMK keymaps
+// don't name a layout, so it is taken from the directory holding the file,
+// as in keymaps/<layout>/<name>.keymap.
+func LoadKeymapFromZMK(keymapPath string, keymapData *KeymapData) error {
+	b, err := os.ReadFile(keymapPath)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(path.Base(keymapPath), path.Ext(keymapPath))
+	err = ParseZMKKeymap(string(b), name, keymapData)
+	if err != nil {
+		return fmt.Errorf("%s: %w", keymapPath, err)
+	}
+
+	keymapData.Layout = path.Base(path.Dir(keymapPath))
+	keymapData.Path = keymapPath
+
+	return nil
+}
+
+// ParseZMKKeymap converts the layers and combos of a ZMK devicetree keymap.
+// Behaviors are mapped onto the QMK keycodes the sequencer understands, e.g.
+// &mt onto MT(), &sk onto OSM() and &sl onto OSL(). Custom hold-taps act like
+// &mt or &lt depending on their bindings. The layout is left for the caller.
+func ParseZMKKeymap(src, name string, keymapData *KeymapData) error {
+	source := preprocessKeymapC(src)
+
+	root, err := parseZMKTree(source.text)
+	if err != nil {
+		return err
+	}
+
+	// custom hold-taps such as home row mods behave like &mt or &lt
+	holdTaps := map[string]string{}
+	for _, behavior := range root.findAll("zmk,behavior-hold-tap") {
+		if behavior.Label == "" {
+			continue
+		}
+
+		holdTaps[behavior.Label] = "mt"
+		bindings := splitZMKBindings(behavior.Props["bindings"])
+		if len(bindings) > 0 && bindings[0][0] == "mo" {
+			holdTaps[behavior.Label] = "lt"
+		}
+	}
+
+	keymapNode := root.find("zmk,keymap")
+	if keymapNode == nil {
+		return fmt.Errorf("could not find keymap node")
+	}
+
+	keymapData.Layers = [][]string{}
+	for _, layerNode := range keymapNode.Children {
+		bindings, ok := layerNode.Props["bindings"]
+		if !ok {
+			continue
+		}
+
+		keys := []string{}
+		for _, binding := range splitZMKBindings(bindings) {
+			keycode, err := zmkBinding(binding, source, holdTaps)
+			if err != nil {
+				return fmt.Errorf("line %d: layer %s: %w", layerNode.Line, layerNode.Name, err)
+			}
+			keys = append(keys, keycode)
+		}
+
+		keymapData.Layers = append(keymapData.Layers, keys)
+	}
+
+	if len(keymapData.Layers) == 0 {
+		return fmt.Errorf("keymap node has no layers")
+	}
+
+	keymapData.Combos = []Combo{}
+	if combosNode := root.find("zmk,combos"); combosNode != nil {
+		for _, comboNode := range combosNode.Children {
+			bindings := splitZMKBindings(comboNode.Props["bindings"])
+			if len(bindings) != 1 {
+				return fmt.Errorf("line %d: combo %s must have one binding", comboNode.Line, comboNode.Name)
+			}
+
+			output, err := zmkBinding(bindings[0], source, holdTaps)
+			if err != nil {
+				return fmt.Errorf("line %d: combo %s: %w", comboNode.Line, comboNode.Name, err)
+			}
+
+			positions, err := zmkCells(comboNode.Props["key-positions"], source)
+			if err != nil {
+				return fmt.Errorf("line %d: combo %s: %w", comboNode.Line, comboNode.Name, err)
+			}
+
+			layers, err := zmkCells(comboNode.Props["layers"], source)
+			if err != nil {
+				return fmt.Errorf("line %d: combo %s: %w", comboNode.Line, comboNode.Name, err)
+			}
+
+			if len(positions) < 2 || output == "KC_NO" {
+				continue
+			}
+
+			keymapData.Combos = append(keymapData.Combos, Combo{
+				Positions: positions,
+				Layers:    layers,
+				Output:    output,
+			})
+		}
+	}
+
+	keymapData.Version = 1
+	keymapData.Keymap = name
+
+	return nil
+}
+
+// parseZMKTree reads the nodes and properties of a preprocessed keymap.
+// Property values are kept as written.
+func parseZMKTree(text string) (*zmkNode, error) {
+	root := &zmkNode{Name: "", Line: 1, Props: map[string]string{}}
+	stack := []*zmkNode{root}
+	start := 0
+	depth := 0
+
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '<', '(':
+			depth += 1
+		case '>', ')':
+			depth -= 1
+		case '"':
+			closing := strings.IndexByte(text[i+1:], '"')
+			if closing == -1 {
+				return nil, fmt.Errorf("line %d: unterminated string", lineAt(text, i))
+			}
+			i += closing + 1
+		case '{':
+			if depth != 0 {
+				continue
+			}
+
+			header := strings.TrimSpace(text[start:i])
+			match := zmkNodeRegex.FindStringSubmatch(header)
+			if match == nil {
+				return nil, fmt.Errorf("line %d: malformed node '%s'", lineAt(text, i), header)
+			}
+
+			node := &zmkNode{Name: match[2], Label: match[1], Line: lineAt(text, i), Props: map[string]string{}}
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, node)
+			stack = append(stack, node)
+			start = i + 1
+		case '}':
+			if depth != 0 {
+				continue
+			}
+
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("line %d: unexpected '}'", lineAt(text, i))
+			}
+
+			stack = stack[:len(stack)-1]
+			start = i + 1
+		case ';':
+			if depth != 0 {
+				continue
+			}
+
+			statement := strings.TrimSpace(text[start:i])
+			start = i + 1
+			if statement == "" {
+				continue
+			}
+
+			name, value, _ := strings.Cut(statement, "=")
+			stack[len(stack)-1].Props[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("line %d: node %s is not closed", stack[len(stack)-1].Line, stack[len(stack)-1].Name)
+	}
+
+	return root, nil
+}
+
+func lineAt(text string, offset int) int {
+	return strings.Count(text[:offset], "\n") + 1
+}
+
+// splitZMKBindings splits a bindings property into one field list per
+// behavior, e.g. <&kp A &mt LSHIFT B> into [&kp A] and [&mt LSHIFT B].
+func splitZMKBindings(value string) [][]string {
+	value = strings.NewReplacer("<", " ", ">", " ", ",", " ").Replace(value)
+
+	bindings := [][]string{}
+	for _, binding := range strings.Split(value, "&")[1:] {
+		fields := strings.Fields(binding)
+		if len(fields) > 0 {
+			bindings = append(bindings, fields)
+		}
+	}
+
+	return bindings
+}
+
+// zmkCells reads a list of numbers such as key-positions = <0 1>.
+func zmkCells(value string, source keymapSource) ([]int, error) {
+	cells := []int{}
+	for _, field := range strings.Fields(strings.NewReplacer("<", " ", ">", " ").Replace(value)) {
+		cell, err := source.evalInt(field)
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, cell)
+	}
+
+	return cells, nil
+}
+
+// zmkBinding converts one behavior binding to a QMK keycode. Behaviors the
+// analyzer can't type, like bluetooth or RGB control, become KC_NO.
+func zmkBinding(fields []string, source keymapSource, holdTaps map[string]string) (string, error) {
+	behavior := fields[0]
+	params := []string{}
+	for _, param := range fields[1:] {
+		params = append(params, source.expand(param, 0))
+	}
+
+	if kind, ok := holdTaps[behavior]; ok {
+		behavior = kind
+	}
+
+	expect := func(count int) error {
+		if len(params) != count {
+			return fmt.Errorf("&%s expects %d parameters, got %d", fields[0], count, len(params))
+		}
+		return nil
+	}
+
+	if keycode, ok := zmkSystemBehaviors[behavior]; ok {
+		return keycode, nil
+	}
+
+	if function, ok := zmkLayerBehaviors[behavior]; ok {
+		if err := expect(1); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s(%s)", function, params[0]), nil
+	}
+
+	switch behavior {
+	case "kp":
+		if err := expect(1); err != nil {
+			return "", err
+		}
+		return zmkKeycode(params[0]), nil
+	case "mt":
+		if err := expect(2); err != nil {
+			return "", err
+		}
+		// hold-taps can hold any key, the analyzer only knows held modifiers
+		mod, err := zmkMod(params[0])
+		if err != nil {
+			fmt.Printf("WARN: &%s holds %s, which is not a modifier, using its tap only. (Results may be inaccurate)\n", fields[0], params[0])
+			return zmkKeycode(params[1]), nil
+		}
+		return fmt.Sprintf("MT(%s,%s)", mod, zmkKeycode(params[1])), nil
+	case "lt":
+		if err := expect(2); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("LT(%s,%s)", params[0], zmkKeycode(params[1])), nil
+	case "sk":
+		if err := expect(1); err != nil {
+			return "", err
+		}
+		// a sticky modifier is a one-shot mod, any other sticky key just types
+		if mod, err := zmkMod(params[0]); err == nil {
+			return fmt.Sprintf("OSM(%s)", mod), nil
+		}
+		return zmkKeycode(params[0]), nil
+	}
+
+	return "KC_NO", nil
+}
+
+// zmkKeycode converts a ZMK key name, including modifier functions like
+// LS(A), to a QMK keycode.
+func zmkKeycode(name string) string {
+	if match := zmkFunctionRegex.FindStringSubmatch(name); match != nil {
+		if function, ok := zmkModFunctions[match[1]]; ok {
+			return fmt.Sprintf("%s(%s)", function, zmkKeycode(match[2]))
+		}
+	}
+
+	if keycode, ok := zmkKeys[name]; ok {
+		return "KC_" + keycode
+	}
+
+	if match := zmkNumberRegex.FindStringSubmatch(name); match != nil {
+		return "KC_" + match[1]
+	}
+
+	if zmkLetterRegex.MatchString(name) || zmkFunctionKey.MatchString(name) {
+		return "KC_" + name
+	}
+
+	fmt.Printf("WARN: unknown ZMK key '%s', using KC_NO. (Results may be inaccurate)\n", name)
+	return "KC_NO"
+}
+
+// zmkMod converts a ZMK modifier key name to its MOD_* constant.
+func zmkMod(name string) (string, error) {
+	keycode, ok := zmkKeys[name]
+	if !ok {
+		return "", fmt.Errorf("unknown modifier %s", name)
+	}
+
+	if _, ok := modMasks[keycode]; !ok {
+		return "", fmt.Errorf("unknown modifier %s", name)
+	}
+
+	return "MOD_" + keycode, nil
+}
@@ -0,0 +1,160 @@
+package qmk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoadKeymapFromZMK(t *testing.T) {
+	keymap := KeymapData{}
+	err := LoadKeymapFromZMK("./test_content/zmk/ferris_sweep_test.keymap", &keymap)
+	NoError(t, err)
+
+	expected := KeymapData{}
+	err = LoadKeymapFromJSON("./test_content/keymaps/LAYOUT_split_3x5_2/ferris_sweep_test.json", &expected)
+	NoError(t, err)
+
+	Equal(t, "ferris_sweep_test", keymap.Keymap)
+	Equal(t, "zmk", keymap.Layout)
+	Equal(t, len(expected.Layers), len(keymap.Layers))
+
+	for i := range expected.Layers {
+		ArrayEqual(t, expected.Layers[i], keymap.Layers[i])
+	}
+
+	Equal(t, 1, len(keymap.Combos))
+	ArrayEqual(t, []int{1, 2}, keymap.Combos[0].Positions)
+	ArrayEqual(t, []int{0}, keymap.Combos[0].Layers)
+	Equal(t, "KC_MINS", keymap.Combos[0].Output)
+}
+
+func TestParseZMKBehaviors(t *testing.T) {
+	src := `
+#define NAV 2
+/ {
+	behaviors {
+		hm: homerow_mods {
+			compatible = "zmk,behavior-hold-tap";
+			#binding-cells = <2>;
+			flavor = "balanced";
+			bindings = <&kp>, <&kp>;
+		};
+		ltq: layer_tap_quick {
+			compatible = "zmk,behavior-hold-tap";
+			bindings = <&mo>, <&kp>;
+		};
+	};
+
+	&mt { tapping-term-ms = <200>; };
+
+	keymap {
+		compatible = "zmk,keymap";
+		base {
+			bindings = <&kp LS(N1) &mt LCTRL A &hm LGUI S &ltq NAV SPACE &mo NAV &to 0 &tog 1 &sl NAV &sk LSHIFT &sk A &bt BT_CLR &none &trans &kp LC(LS(Z)) &kp C_MUTE &kp F12 &kp C_BRI_UP>;
+		};
+	};
+};`
+
+	keymap := KeymapData{}
+	NoError(t, ParseZMKKeymap(src, "test", &keymap))
+
+	expected := []string{
+		"LSFT(KC_1)",
+		"MT(MOD_LCTL,KC_A)",
+		"MT(MOD_LGUI,KC_S)",
+		"LT(2,KC_SPC)",
+		"MO(2)",
+		"TO(0)",
+		"TG(1)",
+		"OSL(2)",
+		"OSM(MOD_LSFT)",
+		"KC_A",
+		"KC_NO",
+		"KC_NO",
+		"KC_TRNS",
+		"LCTL(LSFT(KC_Z))",
+		"KC_MUTE",
+		"KC_F12",
+		"KC_NO",
+	}
+	Equal(t, 1, len(keymap.Layers))
+	ArrayEqual(t, expected, keymap.Layers[0])
+
+	layers, err := keymap.ParseLayers()
+	NoError(t, err)
+	Equal(t, "!", layers[0][0].Default)
+	Equal(t, OneShotModKeycode, layers[0][8].Kind)
+	Equal(t, ModLCtl, layers[0][1].HoldMods)
+}
+
+func TestParseZMKErrors(t *testing.T) {
+	keymap := KeymapData{}
+
+	err := ParseZMKKeymap("/ { combos { compatible = \"zmk,combos\"; }; };", "test", &keymap)
+	ErrorEqual(t, errors.New("could not find keymap node"), err)
+
+	err = ParseZMKKeymap("/ {\n\tkeymap {\n\t\tcompatible = \"zmk,keymap\";\n\t\tbase {\n\t\t\tbindings = <&mt A>;\n\t\t};\n\t};\n};", "test", &keymap)
+	ErrorEqual(t, errors.New("line 4: layer base: &mt expects 2 parameters, got 1"), err)
+
+	err = ParseZMKKeymap("/ {\n\tkeymap {\n", "test", &keymap)
+	ErrorEqual(t, errors.New("line 2: node keymap is not closed"), err)
+}
+
+func TestParseZMKHoldTapNonModifier(t *testing.T) {
+	src := `
+/ {
+	behaviors {
+		ht: hold_tap {
+			compatible = "zmk,behavior-hold-tap";
+			#binding-cells = <2>;
+			bindings = <&kp>, <&kp>;
+		};
+	};
+
+	keymap {
+		compatible = "zmk,keymap";
+		base {
+			bindings = <&ht ESC A &mt ENTER B &ht LSHIFT C>;
+		};
+	};
+};`
+
+	// holding a key that isn't a modifier is left out, the tap still types
+	keymap := KeymapData{}
+	NoError(t, ParseZMKKeymap(src, "test", &keymap))
+	ArrayEqual(t, []string{"KC_A", "KC_B", "MT(MOD_LSFT,KC_C)"}, keymap.Layers[0])
+}
+
+func TestZMKCombo(t *testing.T) {
+	keymap := KeymapData{}
+	err := LoadKeymapFromZMK("./test_content/zmk/ferris_sweep_test.keymap", &keymap)
+	NoError(t, err)
+
+	q, err := NewQMKHelper("./test_content/layouts/", "./test_content/keymaps/", "./test_content/fingermaps/")
+	NoError(t, err)
+
+	fingermap, err := q.LoadFingermapFromJSON("./test_content/fingermaps/LAYOUT_split_3x5_2/ferris_sweep_test.json")
+	NoError(t, err)
+
+	layout, err := q.GetLayoutData("LAYOUT_split_3x5_2")
+	NoError(t, err)
+
+	layers, err := keymap.ParseLayers()
+	NoError(t, err)
+
+	keyfinder, err := CreateKeyfinder(layers, fingermap)
+	NoError(t, err)
+
+	combos, err := CreateCombos(keymap, fingermap)
+	NoError(t, err)
+
+	// the combo is limited to the base layer
+	Equal(t, 1, len(combos["-"]))
+
+	sequencer := NewSequencer(keyfinder, layout)
+	sequencer.Combos = combos
+
+	text := "a-b"
+	sequencer.Build(text)
+	Equal(t, text, sequencer.String(true))
+}